@@ -12,11 +12,12 @@ theoretically be constructed that walks the document tree and follows the spec
 laid out by the current PDF renderer.
 
 The fundamental unit of layout is the document, which forms a list of pages,
-along with some universal settings such as page margin, height, and width.  All
-such settings are set globally at the document level rather than by page,
-because page breaks and positioning are abstracted from userspace.  For
-directly drawing onto a page, or manually managing page breaks, lower level
-access to the renderer than DocSpec currently provides would be required.
+along with some universal settings such as page margin, height, and width.
+Such settings are set at the document level, or for a section of the document,
+rather than by page, because page breaks and positioning are abstracted from
+userspace.  For directly drawing onto a page, or manually managing page
+breaks, lower level access to the renderer than DocSpec currently provides
+would be required.
 */
 
 // Size is the fundmental unit of measurement used for widths, heights,
@@ -52,6 +53,16 @@ type DocumentRenderer interface {
 	// not split.  This is so that a text node can have an inherent width and
 	// height can be used in a Height/WidthAsChildren definition.
 	GetInherentTextRect(textNode TextNode) Rect
+
+	// SplitRichText wraps the spans of a rich text node into lines that fit
+	// into the given rect, in the same way as SplitText.  Each line is made of
+	// the parts of the spans that fall onto that line, so that joining the
+	// lines together gives back the original spans.
+	SplitRichText(targetRect Rect, richTextNode RichTextNode) [][]TextSpan
+
+	// GetInherentRichTextRect gets the width and height that a rich text node
+	// would have if it was not split.
+	GetInherentRichTextRect(richTextNode RichTextNode) Rect
 }
 
 // -----------------------  Simple Types --------------------------
@@ -61,22 +72,59 @@ type DocumentBuilder struct {
 	renderer DocumentRenderer
 	document *Document
 	nodes    []*LayoutNode
+	header   *LayoutNode
+	footer   *LayoutNode
 }
 
-type documentSize = int
+// documentSize is the width and height of a page in mm.  It is the single
+// source of truth for page dimensions: the layout engine uses it to calculate
+// the draw rect of each page, and renderers use the resulting page dimensions
+// to size the pages that they output.
+type documentSize struct {
+	width  Size
+	height Size
+}
 
-const (
+var (
 	// DocumentSizeLetter represents a page with the size U.S. Letter
-	DocumentSizeLetter documentSize = iota
+	DocumentSizeLetter = documentSize{215.9, 279.4}
+	// DocumentSizeLegal represents a page with the size U.S. Legal
+	DocumentSizeLegal = documentSize{215.9, 355.6}
+	// DocumentSizeTabloid represents a page with the size U.S. Tabloid
+	DocumentSizeTabloid = documentSize{279.4, 431.8}
+	// DocumentSizeA3 represents a page with the size ISO A3
+	DocumentSizeA3 = documentSize{297.0, 420.0}
+	// DocumentSizeA4 represents a page with the size ISO A4
+	DocumentSizeA4 = documentSize{210.0, 297.0}
+	// DocumentSizeA5 represents a page with the size ISO A5
+	DocumentSizeA5 = documentSize{148.0, 210.0}
 )
 
-func getDocumentSize(s documentSize) (Size, Size) {
-	switch s {
-	case DocumentSizeLetter:
-		return 216.0, 279.0
+// NewDocumentSize creates a custom page size from a width and height in mm
+func NewDocumentSize(width, height Size) documentSize {
+	return documentSize{width, height}
+}
+
+// Landscape returns the page size turned so that its longest side is
+// horizontal, e.g. `DocumentSizeA4.Landscape()`
+func (s documentSize) Landscape() documentSize {
+	if s.height > s.width {
+		return documentSize{s.height, s.width}
+	}
+	return s
+}
+
+// Portrait returns the page size turned so that its longest side is
+// vertical.  All of the predefined sizes are already in portrait orientation.
+func (s documentSize) Portrait() documentSize {
+	if s.width > s.height {
+		return documentSize{s.height, s.width}
 	}
+	return s
+}
 
-	return 0.0, 0.0
+func getDocumentSize(s documentSize) (Size, Size) {
+	return s.width, s.height
 }
 
 // NewDocumentBuilder creates a new document with the specified margin and size, and a renderer
@@ -101,17 +149,42 @@ func (d *DocumentBuilder) RenderToWriter(writer io.Writer) error {
 	return err
 }
 
+// SetHeader sets a tree of nodes to be repeated at the top of every page,
+// inside of the page's top margin.  Text nodes in the tree may contain the
+// placeholders `PageNumberPlaceholder` and `PageCountPlaceholder`, which are
+// replaced once the document has been split into pages.  A header taller
+// than the top margin of any page fails the layout with an `OverflowError`.
+// Must be called before `CreateDocumentTree`.
+func (d *DocumentBuilder) SetHeader(header *LayoutNode) {
+	d.header = header
+}
+
+// SetFooter sets a tree of nodes to be repeated at the bottom of every page,
+// inside of the page's bottom margin.  See `SetHeader` for details.
+func (d *DocumentBuilder) SetFooter(footer *LayoutNode) {
+	d.footer = footer
+}
+
 // CreateDocumentTree traverses the given list of nodes and calculates the
 // coordinates for all rects in the tree.
 func (d *DocumentBuilder) CreateDocumentTree(nodeList []*LayoutNode) error {
 	d.nodes = nodeList
 	// before we resolve the node rect positions, recursively walk the tree and
-	// set the renderer context
+	// set the renderer context.  Any sizes resolved before now were resolved
+	// in terms of a tree that may have changed since.
 	for _, node := range d.nodes {
 		setDocumentRendererContext(node, d.renderer)
+		node.invalidateSizes()
 	}
 
 	err := resolveNodeRectPositions(d)
+	if err != nil {
+		return err
+	}
+
+	// headers and footers can only be created once we know how many pages
+	// there are going to be
+	err = resolvePageDecorations(d)
 	return err
 }
 
@@ -147,12 +220,12 @@ func prettyPrintNodeTree(root *LayoutNode, depth int) {
 
 	result += "LayoutNode (x: %f, y: %f, w: %f, h: %f, margin: %v, padding: %v) {\n"
 
-	width, err := root.Width.await()
+	width, err := root.getWidth()
 	if err != nil {
 		panic(err)
 	}
 
-	height, err := root.Height.await()
+	height, err := root.getHeight()
 
 	if err != nil {
 		panic(err)
@@ -177,6 +250,9 @@ func prettyPrintNodeTree(root *LayoutNode, depth int) {
 // layout engine to create page breaks, and is thus not exposed to userspace.
 type Document struct {
 	Children []*Page
+	// geometry is the page size and margin given to the document builder,
+	// which applies to every page outside of a section
+	geometry SectionProps
 }
 
 func newDocument(width, height, margin Size) *Document {
@@ -187,8 +263,11 @@ func newDocument(width, height, margin Size) *Document {
 		Margin:   NewSingletonSizeQuad(margin),
 	}
 
+	size := documentSize{width, height}
+	pageMargin := page.Margin
 	document := Document{
 		Children: []*Page{&page},
+		geometry: SectionProps{Size: &size, Margin: &pageMargin},
 	}
 
 	return &document
@@ -201,6 +280,14 @@ type Page struct {
 	Width    Size
 	Height   Size
 	Margin   SizesQuad
+	// Header and Footer are the copies of the document's header and footer
+	// made for this page, wrapped in a node that covers the page's top and
+	// bottom margin respectively.  Either may be nil.
+	Header *LayoutNode
+	Footer *LayoutNode
+	// pending are the top level nodes that are being fitted onto the page, in
+	// order, before they are added to the page's children
+	pending []*LayoutNode
 }
 
 // getDrawRect returns the area inside the page into which we can render child nodes
@@ -214,6 +301,27 @@ func (p *Page) getDrawRect() Rect {
 	return Rect{width, height}
 }
 
+// heightAbove returns the height taken up by the top level nodes in the
+// normal flow that end up on the page above the given node, including the
+// nodes that are still being fitted onto the page
+func (p *Page) heightAbove(node *LayoutNode) (Size, error) {
+	height := emptySize
+	for _, nodes := range [][]*LayoutNode{p.Children, p.pending} {
+		for _, n := range inFlow(nodes) {
+			if n == node {
+				return height, nil
+			}
+
+			h, err := n.getBoundingHeight()
+			if err != nil {
+				return emptySize, err
+			}
+			height += h
+		}
+	}
+	return height, nil
+}
+
 func (p *Page) addNode(node *LayoutNode) {
 	p.Children = append(p.Children, node)
 	node.Page = p
@@ -221,12 +329,42 @@ func (p *Page) addNode(node *LayoutNode) {
 
 func (d *Document) addPage() *Page {
 	previousPage := d.Children[len(d.Children)-1]
+	return d.addPageWithGeometry(previousPage.Width, previousPage.Height, previousPage.Margin)
+}
+
+func (d *Document) addPageWithGeometry(width, height Size, margin SizesQuad) *Page {
 	page := &Page{
 		Children: make([]*LayoutNode, 0),
-		Width:    previousPage.Width,
-		Height:   previousPage.Height,
-		Margin:   previousPage.Margin,
+		Width:    width,
+		Height:   height,
+		Margin:   margin,
 	}
 	d.Children = append(d.Children, page)
 	return page
 }
+
+// startSection returns the page on which a section begins, given the page on
+// which the previous content ended.  The section always starts on a fresh
+// page, but if the previous page is still empty (i.e. the section is the
+// first thing in the document) that page is reused rather than leaving it
+// blank.
+func (d *Document) startSection(previousPage *Page, section SectionProps) *Page {
+	width, height := previousPage.Width, previousPage.Height
+	if section.Size != nil {
+		width, height = getDocumentSize(*section.Size)
+	}
+
+	margin := previousPage.Margin
+	if section.Margin != nil {
+		margin = *section.Margin
+	}
+
+	if len(previousPage.Children) == 0 {
+		previousPage.Width = width
+		previousPage.Height = height
+		previousPage.Margin = margin
+		return previousPage
+	}
+
+	return d.addPageWithGeometry(width, height, margin)
+}
@@ -0,0 +1,197 @@
+package docspec
+
+import (
+	"io"
+	"math"
+	"testing"
+	"time"
+)
+
+// testPageMargin is the margin of the pages of the documents laid out by the
+// tests, which leaves a draw rect of 195.9mm by 259.4mm on a Letter page
+const testPageMargin Size = 10.0
+
+func newTestRenderer(t *testing.T) *PDFRenderer {
+	t.Helper()
+
+	renderer, err := NewPDFRenderer(
+		DocumentSizeLetter,
+		"./example/fonts",
+		FontConfig{Name: "Inter", Style: "", File: "Inter-Regular.json"},
+		FontConfig{Name: "Inter", Style: "B", File: "Inter-Bold.json"},
+		FontConfig{Name: "Inter", Style: "I", File: "Inter-Italic.json"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return renderer
+}
+
+func newTestBuilder(t *testing.T) *DocumentBuilder {
+	t.Helper()
+	return NewDocumentBuilder(newTestRenderer(t), DocumentSizeLetter, testPageMargin)
+}
+
+// layoutNodes lays out the nodes on Letter pages, failing the test if the
+// layout fails
+func layoutNodes(t *testing.T, nodes ...*LayoutNode) *Document {
+	t.Helper()
+
+	builder := newTestBuilder(t)
+	err := builder.CreateDocumentTree(nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return builder.document
+}
+
+// testRect is the position and size of a node's render rect
+type testRect struct {
+	x, y, width, height Size
+}
+
+func rectOf(t *testing.T, node *LayoutNode) testRect {
+	t.Helper()
+
+	rect, err := node.getRenderRect()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testRect{node.X, node.Y, rect.width, rect.height}
+}
+
+func sizesEqual(a, b Size) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func (r testRect) equals(other testRect) bool {
+	return sizesEqual(r.x, other.x) && sizesEqual(r.y, other.y) && sizesEqual(r.width, other.width) && sizesEqual(r.height, other.height)
+}
+
+// pageRects returns the render rects of the top level nodes on each page
+func pageRects(t *testing.T, document *Document) [][]testRect {
+	t.Helper()
+
+	pages := make([][]testRect, len(document.Children))
+	for idx, page := range document.Children {
+		pages[idx] = make([]testRect, 0)
+		for _, node := range page.Children {
+			pages[idx] = append(pages[idx], rectOf(t, node))
+		}
+	}
+
+	return pages
+}
+
+func assertPageRects(t *testing.T, document *Document, expected [][]testRect) {
+	t.Helper()
+
+	actual := pageRects(t, document)
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %d pages, got %d: %+v", len(expected), len(actual), actual)
+	}
+
+	for page := range expected {
+		if len(actual[page]) != len(expected[page]) {
+			t.Fatalf("expected %d nodes on page %d, got %d: %+v", len(expected[page]), page+1, len(actual[page]), actual[page])
+		}
+		for idx := range expected[page] {
+			if !actual[page][idx].equals(expected[page][idx]) {
+				t.Errorf("page %d, node %d: expected %+v, got %+v", page+1, idx, expected[page][idx], actual[page][idx])
+			}
+		}
+	}
+}
+
+// assertLinearScaling lays out the node returned by build for a small and a
+// four times larger size, and fails the test if the layout time grows
+// quadratically rather than linearly with the size.  Each layout is timed a
+// few times, keeping the fastest, to keep the test stable on a busy machine.
+// The nodes should fit on a single page, since a node that is split over
+// many pages is laid out again for every page.
+func assertLinearScaling(t *testing.T, size int, build func(size int) *LayoutNode) {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("timing layouts is slow")
+	}
+
+	layoutTime := func(size int) time.Duration {
+		fastest := time.Duration(math.MaxInt64)
+		for run := 0; run < 3; run++ {
+			node := build(size)
+			start := time.Now()
+			layoutNodes(t, node)
+			if elapsed := time.Since(start); elapsed < fastest {
+				fastest = elapsed
+			}
+		}
+		return fastest
+	}
+
+	small := layoutTime(size)
+	large := layoutTime(size * 4)
+
+	// linear growth would be 4 times slower, and quadratic growth 16 times
+	if large > small*10 {
+		t.Errorf("layout of %d took %v, but layout of %d took %v", size, small, size*4, large)
+	}
+}
+
+// box creates a top level div with a static height that fills the width of
+// the page
+func box(height Size, props LayoutNodeProps) *LayoutNode {
+	props.Width = WidthFill()
+	props.Height = StaticSize(height)
+	return Div(nil, props, NoChildren)
+}
+
+func TestDocumentSizes(t *testing.T) {
+	tests := []struct {
+		name          string
+		size          documentSize
+		width, height Size
+	}{
+		{"letter", DocumentSizeLetter, 215.9, 279.4},
+		{"legal", DocumentSizeLegal, 215.9, 355.6},
+		{"tabloid", DocumentSizeTabloid, 279.4, 431.8},
+		{"A3", DocumentSizeA3, 297, 420},
+		{"A4", DocumentSizeA4, 210, 297},
+		{"A5", DocumentSizeA5, 148, 210},
+		{"custom", NewDocumentSize(100, 150), 100, 150},
+		{"landscape", DocumentSizeA4.Landscape(), 297, 210},
+		{"landscape of a landscape size", NewDocumentSize(150, 100).Landscape(), 150, 100},
+		{"portrait of a landscape size", DocumentSizeLetter.Landscape().Portrait(), 215.9, 279.4},
+		{"portrait of a portrait size", DocumentSizeA5.Portrait(), 148, 210},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			renderer := newTestRenderer(t)
+			builder := NewDocumentBuilder(renderer, test.size, testPageMargin)
+			err := builder.CreateDocumentTree([]*LayoutNode{
+				Div(nil, LayoutNodeProps{Width: WidthFill(), Height: HeightFill()}, NoChildren),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := testRect{testPageMargin, testPageMargin, test.width - 2*testPageMargin, test.height - 2*testPageMargin}
+			assertPageRects(t, builder.document, [][]testRect{{expected}})
+
+			err = builder.RenderToWriter(io.Discard)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// each page of the PDF is rendered at the size of its page
+			width, height, _ := renderer.pdf.PageSize(1)
+			if !sizesEqual(width, test.width) || !sizesEqual(height, test.height) {
+				t.Errorf("expected a PDF page of %fx%f, got %fx%f", test.width, test.height, width, height)
+			}
+		})
+	}
+}
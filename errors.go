@@ -1,6 +1,9 @@
 package docspec
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 func errMsgPrefix() string {
 	return "[docspec]:"
@@ -9,3 +12,135 @@ func errMsgPrefix() string {
 func invariantViolation(msg string) error {
 	return fmt.Errorf("%s %s", errMsgPrefix(), msg)
 }
+
+// NodePath is the path from the root of a tree of nodes to a particular
+// LayoutNode.  Each step names a node by its ID, or by its index within its
+// parent if it has no ID, since most nodes are never given one.
+type NodePath []string
+
+func (p NodePath) String() string {
+	return strings.Join(p, " > ")
+}
+
+// pathOf builds the path from the root of the tree to the given node
+func pathOf(node *LayoutNode) NodePath {
+	path := make(NodePath, 0)
+	for ; node != nil; node = node.Parent {
+		path = append(NodePath{pathStep(node)}, path...)
+	}
+	return path
+}
+
+func pathStep(node *LayoutNode) string {
+	if node.ID != "" {
+		return fmt.Sprintf("node(%s)", node.ID)
+	}
+
+	var siblings []*LayoutNode
+	if node.Parent != nil {
+		siblings = node.Parent.Children
+	} else if node.Page != nil {
+		siblings = node.Page.Children
+	}
+
+	for i, sibling := range siblings {
+		if sibling == node {
+			return fmt.Sprintf("node[%d]", i)
+		}
+	}
+
+	if node.Parent == nil {
+		return "root"
+	}
+	return "node"
+}
+
+// OrphanNodeError is returned when a node is sized relative to its parent,
+// but the parent has no size to speak of in that direction
+type OrphanNodeError struct {
+	Path     NodePath
+	Property string
+	Reason   string
+}
+
+func (e *OrphanNodeError) Error() string {
+	return fmt.Sprintf("%s orphan node %s.%s: %s", errMsgPrefix(), e.Path, e.Property, e.Reason)
+}
+
+// OverflowError is returned when a node is too large to fit into the space
+// available to it, and cannot be split to make it fit, e.g. a top level node
+// that is taller than an empty page
+type OverflowError struct {
+	Path      NodePath
+	Property  string
+	Size      Size
+	Available Size
+}
+
+func (e *OverflowError) Error() string {
+	return fmt.Sprintf("%s node %s.%s of %f cannot be split to fit into %f", errMsgPrefix(), e.Path, e.Property, e.Size, e.Available)
+}
+
+// InvalidSizeError is returned when a size is given a value that it can never
+// take, such as an aspect ratio of 0
+type InvalidSizeError struct {
+	Path     NodePath
+	Property string
+	Size     Size
+	Reason   string
+}
+
+func (e *InvalidSizeError) Error() string {
+	return fmt.Sprintf("%s node %s.%s: invalid size %f: %s", errMsgPrefix(), e.Path, e.Property, e.Size, e.Reason)
+}
+
+// CycleError is returned when a future is defined in terms of itself.  Path
+// and Property identify the future at which the cycle was detected, and Steps
+// lists the futures that form the cycle, in the order in which they await
+// each other.
+type CycleError struct {
+	Path     NodePath
+	Property string
+	Steps    []string
+
+	// the future at which the cycle was detected
+	start *Future
+	// complete is set once the error has unwound all the way back to the
+	// start of the cycle
+	complete bool
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("%s circular size dependency: %s", errMsgPrefix(), strings.Join(e.Steps, " -> "))
+}
+
+// UnsupportedVisualNodeError is returned when a visual node is used in a way
+// that its type does not support, such as a renderer being asked to draw a
+// type that it does not know, or a node being sized as its children when its
+// visual node has no inherent size
+type UnsupportedVisualNodeError struct {
+	Path     NodePath
+	Property string
+	Type     string
+}
+
+func (e *UnsupportedVisualNodeError) Error() string {
+	return fmt.Sprintf("%s node %s.%s: unsupported visual node type %s", errMsgPrefix(), e.Path, e.Property, e.Type)
+}
+
+// ImageDecodeError is returned when the data of an image node cannot be read
+// or decoded.  The underlying error is available through errors.Unwrap.
+type ImageDecodeError struct {
+	Path     NodePath
+	Property string
+	Src      string
+	Err      error
+}
+
+func (e *ImageDecodeError) Error() string {
+	return fmt.Sprintf("%s node %s.%s: cannot decode image %s: %v", errMsgPrefix(), e.Path, e.Property, e.Src, e.Err)
+}
+
+func (e *ImageDecodeError) Unwrap() error {
+	return e.Err
+}
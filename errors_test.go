@@ -0,0 +1,168 @@
+package docspec
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+// layoutError lays out the nodes and returns the error that the layout fails
+// with
+func layoutError(t *testing.T, nodes ...*LayoutNode) error {
+	t.Helper()
+
+	err := newTestBuilder(t).CreateDocumentTree(nodes)
+	if err == nil {
+		t.Fatal("expected the layout to fail")
+	}
+	return err
+}
+
+// assertCycleSteps checks that the error is a cycle error passing through the
+// given futures
+func assertCycleSteps(t *testing.T, err error, expected ...string) {
+	t.Helper()
+
+	var cycle *CycleError
+	if !errors.As(err, &cycle) {
+		t.Fatalf("expected a cycle error, got %v", err)
+	}
+	if len(cycle.Steps) != len(expected) {
+		t.Fatalf("expected the steps %v, got %v", expected, cycle.Steps)
+	}
+	for idx := range expected {
+		if cycle.Steps[idx] != expected[idx] {
+			t.Fatalf("expected the steps %v, got %v", expected, cycle.Steps)
+		}
+	}
+}
+
+func TestTypedLayoutErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		nodes func() []*LayoutNode
+		check func(t *testing.T, err error)
+	}{
+		{
+			name: "orphan node",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{Div(nil, LayoutNodeProps{ID: "parent", Width: StaticSize(0), Height: StaticSize(10)}, func(parent *LayoutNode) {
+					Div(parent, LayoutNodeProps{Width: WidthPercentage(50), Height: StaticSize(10)}, NoChildren)
+				})}
+			},
+			check: func(t *testing.T, err error) {
+				var orphan *OrphanNodeError
+				if !errors.As(err, &orphan) || orphan.Path.String() != "node(parent) > node[0]" || orphan.Property != "Width" {
+					t.Errorf("expected an orphan error for node(parent) > node[0].Width, got %v", err)
+				}
+			},
+		},
+		{
+			name: "overflow",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{box(300, LayoutNodeProps{ID: "tall"})}
+			},
+			check: func(t *testing.T, err error) {
+				var overflow *OverflowError
+				if !errors.As(err, &overflow) || overflow.Path.String() != "node(tall)" || overflow.Size != 300 || !sizesEqual(overflow.Available, 259.4) {
+					t.Errorf("expected an overflow error for node(tall), got %v", err)
+				}
+			},
+		},
+		{
+			name: "cycle",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{Div(nil, LayoutNodeProps{ID: "parent", Width: WidthAsChildren(), Height: StaticSize(10)}, func(parent *LayoutNode) {
+					Div(parent, LayoutNodeProps{ID: "child", Width: WidthFill(), Height: StaticSize(10)}, NoChildren)
+				})}
+			},
+			check: func(t *testing.T, err error) {
+				assertCycleSteps(t, err, "node(parent).Width", "node(parent) > node(child).Width", "node(parent).Width")
+			},
+		},
+		{
+			name: "cycle through an expression",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{Div(nil, LayoutNodeProps{ID: "parent", Width: WidthAsChildren().Plus(StaticSize(10)), Height: StaticSize(10)}, func(parent *LayoutNode) {
+					Div(parent, LayoutNodeProps{ID: "child", Width: WidthFill(), Height: StaticSize(10)}, NoChildren)
+				})}
+			},
+			check: func(t *testing.T, err error) {
+				assertCycleSteps(t, err, "node(parent).Width", "node(parent).Width[0]", "node(parent) > node(child).Width", "node(parent).Width")
+			},
+		},
+		{
+			name: "invalid aspect ratio",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{Div(nil, LayoutNodeProps{ID: "banner", Width: WidthFill(), Height: HeightFromAspectRatio(0)}, NoChildren)}
+			},
+			check: func(t *testing.T, err error) {
+				var invalid *InvalidSizeError
+				if !errors.As(err, &invalid) || invalid.Path.String() != "node(banner)" || invalid.Property != "Height" {
+					t.Errorf("expected an invalid size error for node(banner).Height, got %v", err)
+				}
+			},
+		},
+		{
+			name: "image ratio of a node that isn't an image",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{Text(nil, LayoutNodeProps{ID: "caption", Width: WidthFromImageRatio(), Height: StaticSize(10)}, TextNode{Text: "caption"})}
+			},
+			check: func(t *testing.T, err error) {
+				var unsupported *UnsupportedVisualNodeError
+				if !errors.As(err, &unsupported) || unsupported.Path.String() != "node(caption)" || unsupported.Property != "Width" || unsupported.Type != "docspec.TextNode" {
+					t.Errorf("expected an unsupported visual node error for node(caption).Width, got %v", err)
+				}
+			},
+		},
+		{
+			name: "image that can't be read",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{Image(nil, LayoutNodeProps{ID: "logo", Width: StaticSize(10), Height: HeightFromImageRatio()}, ImageNode{Src: "./example/missing.jpg"})}
+			},
+			check: func(t *testing.T, err error) {
+				var decode *ImageDecodeError
+				if !errors.As(err, &decode) || decode.Path.String() != "node(logo) > node[0]" || !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("expected an image decode error for node(logo) > node[0], got %v", err)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.check(t, layoutError(t, test.nodes()...))
+		})
+	}
+}
+
+func TestCycleErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		node     func() *LayoutNode
+		expected []string
+	}{
+		{
+			name: "parent sized as its children with a child that fills it",
+			node: func() *LayoutNode {
+				return Div(nil, LayoutNodeProps{ID: "parent", Width: WidthFill(), Height: HeightAsChildren()}, func(parent *LayoutNode) {
+					Div(parent, LayoutNodeProps{ID: "child", Width: WidthFill(), Height: HeightFill()}, NoChildren)
+				})
+			},
+			expected: []string{"node(parent).Height", "node(parent) > node(child).Height", "node(parent).Height"},
+		},
+		{
+			name: "node sized in terms of itself",
+			node: func() *LayoutNode {
+				return Div(nil, LayoutNodeProps{ID: "square", Width: WidthFromAspectRatio(1), Height: HeightFromAspectRatio(1)}, NoChildren)
+			},
+			expected: []string{"node(square).Height", "node(square).Width", "node(square).Height"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assertCycleSteps(t, layoutError(t, test.node()), test.expected...)
+		})
+	}
+}
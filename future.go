@@ -3,6 +3,8 @@ package docspec
 import (
 	"errors"
 	"fmt"
+	"math"
+	"reflect"
 )
 
 // ------------------- future data type --------------------------
@@ -19,6 +21,11 @@ type futureDefinition = func(node *LayoutNode, params interface{}) (Size, error)
 const (
 	futureIncomplete futureState = iota
 	futureComplete
+	// futureCached is the state of a future whose value has been resolved
+	// during the current layout pass.  Unlike a complete future, the value
+	// is thrown away if the tree changes in a way that could affect it, see
+	// `invalidate`.
+	futureCached
 )
 
 // Future is a datatype modeling a value defined by a recursive function that
@@ -33,6 +40,18 @@ type Future struct {
 	definition futureDefinition
 	params     interface{}
 	node       *LayoutNode
+	// fill is set for futures which share the space left over in the
+	// parent with the node's siblings, see `flexibleSize`
+	fill bool
+	// relative is set for futures which are measured against the draw rect
+	// of the parent, i.e. percentages and fills
+	relative bool
+	// property is the name of the property of the node that the future
+	// belongs to, and is used to describe the future in errors
+	property string
+	// resolving is set while the future's definition is being evaluated, in
+	// order to detect futures that are defined in terms of themselves
+	resolving bool
 }
 
 func (f Future) isUnitialized() bool {
@@ -69,22 +88,91 @@ func newCompleteFuture(value Size) Future {
 }
 
 // await gets the value from a future, and returns the value, or an error in
-// case the value cannot be resolved
-// TODO: it would be really nice to detect infinitely recursive situations,
-// such as when a parent is defined as a function of its children, but the
-// children are defined as a function of their parent, without just having Go's
-// runtime stack overflow.  The resolver ought to detect that this is an
-// invalid state of affairs before attempting to resolve the value.
+// case the value cannot be resolved.  Futures are commonly defined in terms of
+// other futures, so if the definition of a future ends up awaiting the very
+// same future again (e.g. a parent is sized as its children, but the children
+// fill their parent), the value can never be resolved, and a cycle error
+// describing the chain of futures involved is returned instead.
 func (f *Future) await() (Size, error) {
 	if f.node == nil {
 		return emptySize, invariantViolation("future's node is nil.  This indicates an error in a constructor for LayoutNode, as a LayoutNode constructor should always assign the node to each future in the node")
 	}
 
-	if f.state == futureComplete {
+	if f.state == futureComplete || f.state == futureCached {
 		return f.value, nil
 	}
 
-	return f.definition(f.node, f.params)
+	if f.resolving {
+		return emptySize, &CycleError{
+			Path:     pathOf(f.node),
+			Property: f.property,
+			Steps:    []string{f.describe()},
+			start:    f,
+		}
+	}
+
+	f.resolving = true
+	value, err := f.definition(f.node, f.params)
+	f.resolving = false
+
+	if err != nil {
+		// record each future that the cycle passes through on the way back
+		// up to the future at which it started
+		var cycle *CycleError
+		if errors.As(err, &cycle) && !cycle.complete && f.property != "" {
+			cycle.Steps = append([]string{f.describe()}, cycle.Steps...)
+			cycle.complete = cycle.start == f
+		}
+		return emptySize, err
+	}
+
+	// most futures are defined in terms of other futures, and are awaited
+	// many times over during layout (e.g. a fill awaits the size of every
+	// sibling), so the value is kept until the future is invalidated
+	f.value = value
+	f.state = futureCached
+
+	return value, nil
+}
+
+// invalidate throws away the cached value of the future, so that it is
+// resolved again the next time it is awaited
+func (f *Future) invalidate() {
+	if f.state == futureCached {
+		f.value = emptySize
+		f.state = futureIncomplete
+	}
+
+	if expression, ok := f.params.(futureExpression); ok {
+		for idx := range expression.operands {
+			expression.operands[idx].invalidate()
+		}
+	}
+}
+
+// bind points the future at the node and property that it belongs to.  The
+// operands of an expression are bound to the same node, and named after their
+// position in the expression, e.g. "Height[0]".  Each binding gets its own
+// copy of the operands, so that copies of a node don't share cached values.
+func (f *Future) bind(node *LayoutNode, property string) {
+	f.node = node
+	f.property = property
+
+	if expression, ok := f.params.(futureExpression); ok {
+		operands := make([]Future, len(expression.operands))
+		copy(operands, expression.operands)
+		for idx := range operands {
+			operands[idx].bind(node, fmt.Sprintf("%s[%d]", property, idx))
+		}
+		expression.operands = operands
+		f.params = expression
+	}
+}
+
+// describe names the future in terms of the node and property that it belongs
+// to, e.g. "node(header).Height"
+func (f *Future) describe() string {
+	return fmt.Sprintf("%s.%s", pathOf(f.node), f.property)
 }
 
 // isKnown tells us whether the value of the future is already known.  This is
@@ -94,12 +182,20 @@ func (f *Future) await() (Size, error) {
 // width would result in a stack overflow because document trees are always
 // walked from the top down.
 func (f *Future) isKnown() bool {
-	return f.state == futureComplete
+	return f.state == futureComplete || f.state == futureCached
 }
 
 // ------------------- common future definitions --------------------------
 
 func heightAsChildren(node *LayoutNode, params interface{}) (Size, error) {
+	if node.grid != nil {
+		// the sum of the heights of the rows
+		height, err := node.gridContentSize(FlowVertical)
+		if err != nil {
+			return emptySize, err
+		}
+		return height + node.Padding.top + node.Padding.bottom, nil
+	}
 
 	if len(node.Children) == 1 && node.Children[0].VisualNode != nil {
 		childNode := node.Children[0]
@@ -107,30 +203,70 @@ func heightAsChildren(node *LayoutNode, params interface{}) (Size, error) {
 		// inherent size, which we should use if possible
 		switch childNode.VisualNode.(type) {
 		case TextNode:
-			return childNode.rendererContext.GetInherentTextRect(childNode.VisualNode.(TextNode)).height + node.Padding.top + node.Padding.bottom, nil
+			// the height of a text node is the height of all of its lines
+			// once it has been wrapped to the width of the node
+			textNode := childNode.VisualNode.(TextNode)
+			width, err := node.getDrawWidth()
+			if err != nil {
+				return emptySize, err
+			}
+			if width <= 0 {
+				return emptySize, &OrphanNodeError{Path: pathOf(node), Property: "Height", Reason: "cannot wrap text into a width of 0"}
+			}
+			lines := childNode.rendererContext.SplitText(Rect{width, math.MaxFloat64}, textNode)
+			return float64(len(lines))*textNode.getLineHeightMM() + node.Padding.top + node.Padding.bottom, nil
+		case RichTextNode:
+			// lines of rich text are as tall as the largest font on them
+			richTextNode := childNode.VisualNode.(RichTextNode)
+			width, err := node.getDrawWidth()
+			if err != nil {
+				return emptySize, err
+			}
+			if width <= 0 {
+				return emptySize, &OrphanNodeError{Path: pathOf(node), Property: "Height", Reason: "cannot wrap text into a width of 0"}
+			}
+			height := node.Padding.top + node.Padding.bottom
+			for _, line := range childNode.rendererContext.SplitRichText(Rect{width, math.MaxFloat64}, richTextNode) {
+				height += richTextNode.getLineHeightMM(line)
+			}
+			return height, nil
 		default:
-			return emptySize, errors.New("requested height as children, but reached a leaf node with no inherent height")
+			return emptySize, &UnsupportedVisualNodeError{Path: pathOf(node), Property: "Height", Type: reflect.TypeOf(childNode.VisualNode).String()}
 		}
 	}
 
-	if node.ChildFlowDirection == FlowHorizontal {
-		// get the height of the tallest child
-		tallest := 0.0
-		for _, child := range node.Children {
-			cH, err := child.getBoundingHeight()
+	if node.ChildFlowDirection == FlowHorizontal && node.ChildWrap {
+		// get the sum of the heights of the tallest child in each line
+		lines, err := node.wrapLines()
+		if err != nil {
+			return emptySize, err
+		}
+
+		result := totalGap(node.RowGap, len(lines))
+		for _, line := range lines {
+			tallest, err := tallestBoundingHeight(line)
 			if err != nil {
 				return emptySize, err
 			}
-			height := cH
-			if height > tallest {
-				tallest = height
-			}
+			result += tallest
+		}
+		return result + node.Padding.top + node.Padding.bottom, nil
+	}
+
+	// children which are out of the normal flow don't take up any space
+	children := node.flowChildren()
+
+	if node.ChildFlowDirection == FlowHorizontal {
+		// get the height of the tallest child
+		tallest, err := tallestBoundingHeight(children)
+		if err != nil {
+			return emptySize, err
 		}
 		return tallest + node.Padding.top + node.Padding.bottom, nil
 	}
-	// get the sum of the heights of the children
-	result := emptySize
-	for _, child := range node.Children {
+	// get the sum of the heights of the children, and the gaps between them
+	result := totalGap(node.RowGap, len(children))
+	for _, child := range children {
 		cH, err := child.getBoundingHeight()
 		if err != nil {
 			return emptySize, err
@@ -142,7 +278,32 @@ func heightAsChildren(node *LayoutNode, params interface{}) (Size, error) {
 	return result + node.Padding.top + node.Padding.bottom, nil
 }
 
+// tallestBoundingHeight returns the bounding height of the tallest node in the
+// list
+func tallestBoundingHeight(nodes []*LayoutNode) (Size, error) {
+	tallest := 0.0
+	for _, child := range nodes {
+		height, err := child.getBoundingHeight()
+		if err != nil {
+			return emptySize, err
+		}
+		if height > tallest {
+			tallest = height
+		}
+	}
+	return tallest, nil
+}
+
 func widthAsChildren(node *LayoutNode, params interface{}) (Size, error) {
+	if node.grid != nil {
+		// the sum of the widths of the columns
+		width, err := node.gridContentSize(FlowHorizontal)
+		if err != nil {
+			return emptySize, err
+		}
+		return width + node.Padding.left + node.Padding.right, nil
+	}
+
 	// in the case that we're dealing with a node that wraps a visual node, we
 	// can handle the case in a special way, because if said node has it's
 	// width defined as widthAsChildren (which we do, since we're in that
@@ -156,15 +317,20 @@ func widthAsChildren(node *LayoutNode, params interface{}) (Size, error) {
 		switch childNode.VisualNode.(type) {
 		case TextNode:
 			return childNode.rendererContext.GetInherentTextRect(childNode.VisualNode.(TextNode)).width + node.Padding.left + node.Padding.right, nil
+		case RichTextNode:
+			return childNode.rendererContext.GetInherentRichTextRect(childNode.VisualNode.(RichTextNode)).width + node.Padding.left + node.Padding.right, nil
 		default:
-			return emptySize, errors.New("requested width as children, but reached a leaf node with no inherent height")
+			return emptySize, &UnsupportedVisualNodeError{Path: pathOf(node), Property: "Width", Type: reflect.TypeOf(childNode.VisualNode).String()}
 		}
 	}
 
+	// children which are out of the normal flow don't take up any space
+	children := node.flowChildren()
+
 	if node.ChildFlowDirection == FlowVertical {
 		// get the width of the widest child
 		widest := 0.0
-		for _, child := range node.Children {
+		for _, child := range children {
 			cW, err := child.getBoundingWidth()
 			if err != nil {
 				return emptySize, err
@@ -177,9 +343,9 @@ func widthAsChildren(node *LayoutNode, params interface{}) (Size, error) {
 
 		return widest + node.Padding.left + node.Padding.right, nil
 	}
-	// sums the widths of the children
-	result := emptySize
-	for _, child := range node.Children {
+	// sums the widths of the children, and the gaps between them
+	result := totalGap(node.ColumnGap, len(children))
+	for _, child := range children {
 		cW, err := child.getBoundingWidth()
 		if err != nil {
 			return emptySize, err
@@ -195,7 +361,14 @@ func widthAsChildren(node *LayoutNode, params interface{}) (Size, error) {
 }
 
 func heightFill(node *LayoutNode, params interface{}) (Size, error) {
-	result := emptySize
+	if node.isOutOfFlow() {
+		// there are no siblings to share the space with
+		return heightPercentage(node, 100.0)
+	}
+
+	if node.Parent != nil && node.Parent.grid != nil {
+		return gridFill(node, FlowVertical)
+	}
 
 	parentHeight := emptySize
 	var siblings []*LayoutNode
@@ -208,46 +381,52 @@ func heightFill(node *LayoutNode, params interface{}) (Size, error) {
 			return emptySize, err
 		}
 		parentHeight = h
-		siblings = node.Parent.Children
+		siblings = node.Parent.flowChildren()
 		flowDirection = node.Parent.ChildFlowDirection
 	} else if node.Page != nil {
-		parentDrawRect := node.Page.getDrawRect()
-		parentHeight = parentDrawRect.height
-		siblings = node.Page.Children
+		// a top level node has no flexible siblings: it fills whatever is
+		// left of the page below the nodes before it, since the nodes after
+		// it move on to the next page if there is no space left for them.  A
+		// node with no space left at all starts the next page, and fills
+		// that instead.
+		pageHeight := node.Page.getDrawRect().height
+		above, err := node.Page.heightAbove(node)
+		if err != nil {
+			return emptySize, err
+		}
+		parentHeight = pageHeight - above
+		if parentHeight <= layoutEpsilon {
+			parentHeight = pageHeight
+		}
 		flowDirection = FlowVertical
 	}
 
 	if parentHeight == emptySize {
-		return result, fmt.Errorf("orphan node(%s): parent has height of 0", node.ID)
+		return emptySize, &OrphanNodeError{Path: pathOf(node), Property: "Height", Reason: "parent has height of 0"}
 	}
 
 	if flowDirection == FlowHorizontal {
 		return heightPercentage(node, 100.0)
 	}
 
-	siblingHeights := emptySize
-	for _, siblingNode := range siblings {
-		if siblingNode != node {
-			hR, e := siblingNode.getBoundingHeight()
-			if e != nil {
-				return emptySize, e
-			}
-			siblingHeights += hR
-		}
+	if node.Parent != nil {
+		parentHeight -= totalGap(node.Parent.RowGap, len(siblings))
 	}
 
-	result = parentHeight - siblingHeights
-	result -= node.Margin.top + node.Margin.bottom
-
-	// return the difference between the parent height and all the sibling heights
-	return result, nil
+	return flexibleSize(node, parentHeight, siblings, FlowVertical)
 }
 
 func widthFill(node *LayoutNode, params interface{}) (Size, error) {
-	result := emptySize
+	if node.isOutOfFlow() {
+		// there are no siblings to share the space with
+		return widthPercentage(node, 100.0)
+	}
+
+	if node.Parent != nil && node.Parent.grid != nil {
+		return gridFill(node, FlowHorizontal)
+	}
 
 	parentWidth := emptySize
-	var siblings []*LayoutNode
 	var flowDirection childFlowDirection
 
 	// first attempt to use the parent node
@@ -257,46 +436,194 @@ func widthFill(node *LayoutNode, params interface{}) (Size, error) {
 			return emptySize, err
 		}
 		parentWidth = w
-		siblings = node.Parent.Children
 		flowDirection = node.Parent.ChildFlowDirection
 	} else if node.Page != nil {
 		parentDrawRect := node.Page.getDrawRect()
 		parentWidth = parentDrawRect.width
-		siblings = node.Page.Children
 		flowDirection = FlowVertical
 	}
 
 	if parentWidth == emptySize {
-		return result, fmt.Errorf("orphan node(%s): parent has width of 0", node.ID)
+		return emptySize, &OrphanNodeError{Path: pathOf(node), Property: "Width", Reason: "parent has width of 0"}
 	}
 
 	if flowDirection == FlowVertical {
 		return widthPercentage(node, 100.0)
 	}
 
-	siblingWidths := emptySize
-	for _, siblingNode := range siblings {
-		if siblingNode != node {
-			wR, e := siblingNode.getBoundingWidth()
-			if e != nil {
-				return emptySize, e
+	// only a node whose parent lays its children out in a row has siblings to
+	// share its width with, so they aren't looked up until now
+	siblings := node.Parent.flowChildren()
+
+	if node.Parent != nil && node.Parent.ChildWrap {
+		// when the children wrap, only the siblings on the same line share
+		// the free space
+		lines, err := node.Parent.wrapLines()
+		if err != nil {
+			return emptySize, err
+		}
+		for _, line := range lines {
+			for _, sibling := range line {
+				if sibling == node {
+					siblings = line
+				}
 			}
-			siblingWidths += wR
 		}
 	}
 
-	result = parentWidth - siblingWidths
-	result -= node.Margin.left + node.Margin.right
+	if node.Parent != nil {
+		parentWidth -= totalGap(node.Parent.ColumnGap, len(siblings))
+	}
 
-	// return the difference between the parent Width and all the sibling Widths
-	return result, nil
+	return flexibleSize(node, parentWidth, siblings, FlowHorizontal)
+}
+
+// flexibleSize resolves the size of a node along the main axis of its parent
+// (the axis along which the parent's children flow), when that size is a
+// fill.  The space left over in the parent after all of the inflexible
+// siblings and the basis of every flexible sibling is distributed between the
+// flexible siblings according to their grow factors, or taken away from them
+// according to their shrink factors if there is not enough space.  Flexible
+// siblings are never measured in terms of each other, which means that any
+// number of fills can share a parent.
+//
+// As in CSS, a flexible sibling whose share would break its min or max size
+// is frozen at that size, and the free space is distributed again between the
+// rest of the flexible siblings.
+func flexibleSize(node *LayoutNode, available Size, siblings []*LayoutNode, axis childFlowDirection) (Size, error) {
+	type flexItem struct {
+		node    *LayoutNode
+		grow    Size
+		shrink  Size
+		basis   Size
+		margins Size
+	}
+
+	free := available
+	items := make([]flexItem, 0)
+	// the index of the node in the list of flexible items
+	nodeItem := 0
+
+	// the node isn't necessarily in the list of siblings yet, e.g. for top
+	// level nodes which haven't been added to their page
+	nodes := make([]*LayoutNode, 0, len(siblings)+1)
+	for _, sibling := range siblings {
+		if sibling != node {
+			nodes = append(nodes, sibling)
+		}
+	}
+	nodes = append(nodes, node)
+
+	for _, sibling := range nodes {
+		mainSize := sibling.Height
+		margins := sibling.Margin.top + sibling.Margin.bottom
+		if axis == FlowHorizontal {
+			mainSize = sibling.Width
+			margins = sibling.Margin.left + sibling.Margin.right
+		}
+
+		// siblings whose size is a fill, or an expression containing a fill
+		// (see `Future.Plus` etc.), are flexible, and the node itself always
+		// is, since it is only being measured because of a fill
+		if !mainSize.fill && sibling != node {
+			var size Size
+			var err error
+			if axis == FlowHorizontal {
+				size, err = sibling.getBoundingWidth()
+			} else {
+				size, err = sibling.getBoundingHeight()
+			}
+			if err != nil {
+				return emptySize, err
+			}
+			free -= size
+			continue
+		}
+
+		grow, shrink, basisFuture := sibling.flexFactors()
+		basis := emptySize
+		if basisFuture != nil {
+			b, err := basisFuture.await()
+			if err != nil {
+				return emptySize, err
+			}
+			basis = b
+		}
+
+		if sibling == node {
+			nodeItem = len(items)
+		}
+		items = append(items, flexItem{sibling, grow, shrink, basis, margins})
+	}
+
+	frozen := make(map[*LayoutNode]Size)
+
+	for {
+		remaining := free
+		totalGrow := emptySize
+		totalShrink := emptySize
+		totalScaledShrink := emptySize
+
+		for _, item := range items {
+			if size, ok := frozen[item.node]; ok {
+				remaining -= size + item.margins
+				continue
+			}
+
+			remaining -= item.basis + item.margins
+			totalGrow += item.grow
+			totalShrink += item.shrink
+			totalScaledShrink += item.shrink * item.basis
+		}
+
+		// as in CSS, if the factors add up to less than one then only that
+		// fraction of the free space is distributed
+		share := func(item flexItem) Size {
+			result := item.basis
+			if remaining > 0 && totalGrow > 0 {
+				result += remaining * math.Min(totalGrow, 1.0) * (item.grow / totalGrow)
+			} else if remaining < 0 && totalScaledShrink > 0 {
+				result += remaining * math.Min(totalShrink, 1.0) * (item.shrink * item.basis / totalScaledShrink)
+			}
+			return math.Max(result, emptySize)
+		}
+
+		violated := false
+		for _, item := range items {
+			if _, ok := frozen[item.node]; ok {
+				continue
+			}
+
+			size := share(item)
+			if clamped := item.node.clampSize(axis, size); clamped != size {
+				frozen[item.node] = clamped
+				violated = true
+			}
+		}
+
+		if size, ok := frozen[node]; ok {
+			return size, nil
+		}
+
+		if !violated {
+			return share(items[nodeItem]), nil
+		}
+	}
 }
 
 func widthPercentage(node *LayoutNode, params interface{}) (Size, error) {
 	var parentDrawWidth Size
 	result := emptySize
 
-	if node.Parent != nil {
+	if node.Parent != nil && node.Parent.grid != nil && !node.isOutOfFlow() {
+		// children of a grid are sized relative to their area
+		_, width, err := node.Parent.gridCellSpan(node, FlowHorizontal)
+		if err != nil {
+			return result, err
+		}
+
+		parentDrawWidth = width
+	} else if node.Parent != nil {
 		r, err := node.Parent.getDrawWidth()
 		if err != nil {
 			return result, err
@@ -308,7 +635,7 @@ func widthPercentage(node *LayoutNode, params interface{}) (Size, error) {
 	}
 
 	if parentDrawWidth == 0 {
-		return result, fmt.Errorf("orphan node(%s): parent has width of 0", node.ID)
+		return result, &OrphanNodeError{Path: pathOf(node), Property: "Width", Reason: "parent has width of 0"}
 	}
 
 	percentage := params.(Size)
@@ -321,7 +648,14 @@ func heightPercentage(node *LayoutNode, params interface{}) (Size, error) {
 	var parentDrawHeight Size
 	result := emptySize
 
-	if node.Parent != nil {
+	if node.Parent != nil && node.Parent.grid != nil && !node.isOutOfFlow() {
+		// children of a grid are sized relative to their area
+		_, height, err := node.Parent.gridCellSpan(node, FlowVertical)
+		if err != nil {
+			return result, err
+		}
+		parentDrawHeight = height
+	} else if node.Parent != nil {
 		r, err := node.Parent.getDrawHeight()
 		if err != nil {
 			return result, err
@@ -332,7 +666,7 @@ func heightPercentage(node *LayoutNode, params interface{}) (Size, error) {
 	}
 
 	if parentDrawHeight == 0 {
-		return result, fmt.Errorf("orphan node(%s): parent has height of 0", node.ID)
+		return result, &OrphanNodeError{Path: pathOf(node), Property: "Height", Reason: "parent has height of 0"}
 	}
 
 	percentage := params.(Size)
@@ -341,18 +675,98 @@ func heightPercentage(node *LayoutNode, params interface{}) (Size, error) {
 	return result, nil
 }
 
+// aspectRatio returns the ratio (width / height) given as the params of an
+// aspect ratio future, or the intrinsic ratio of the node's image if the
+// params are nil.  The property is the one that the future belongs to.
+func aspectRatio(node *LayoutNode, property string, params interface{}) (Size, error) {
+	if params != nil {
+		ratio := params.(Size)
+		if ratio <= 0 {
+			return emptySize, &InvalidSizeError{Path: pathOf(node), Property: property, Size: ratio, Reason: "aspect ratio must be greater than 0"}
+		}
+		return ratio, nil
+	}
+
+	if len(node.Children) == 1 {
+		if imageNode, ok := node.Children[0].VisualNode.(ImageNode); ok {
+			ratio, err := imageNode.getAspectRatio()
+			if err != nil {
+				return emptySize, &ImageDecodeError{Path: pathOf(node.Children[0]), Property: "VisualNode", Src: imageNode.Src, Err: err}
+			}
+			return ratio, nil
+		}
+	}
+
+	// only images have an intrinsic ratio
+	visualType := "none"
+	if len(node.Children) == 1 && node.Children[0].VisualNode != nil {
+		visualType = reflect.TypeOf(node.Children[0].VisualNode).String()
+	}
+	return emptySize, &UnsupportedVisualNodeError{Path: pathOf(node), Property: property, Type: visualType}
+}
+
+func heightFromAspectRatio(node *LayoutNode, params interface{}) (Size, error) {
+	ratio, err := aspectRatio(node, "Height", params)
+	if err != nil {
+		return emptySize, err
+	}
+
+	if params == nil {
+		// the image is drawn into the draw rect, so that is what needs to
+		// have the image's ratio
+		width, err := node.getDrawWidth()
+		if err != nil {
+			return emptySize, err
+		}
+		return width/ratio + node.Padding.top + node.Padding.bottom, nil
+	}
+
+	width, err := node.getWidth()
+	if err != nil {
+		return emptySize, err
+	}
+
+	return width / ratio, nil
+}
+
+func widthFromAspectRatio(node *LayoutNode, params interface{}) (Size, error) {
+	ratio, err := aspectRatio(node, "Width", params)
+	if err != nil {
+		return emptySize, err
+	}
+
+	if params == nil {
+		height, err := node.getDrawHeight()
+		if err != nil {
+			return emptySize, err
+		}
+		return height*ratio + node.Padding.left + node.Padding.right, nil
+	}
+
+	height, err := node.getHeight()
+	if err != nil {
+		return emptySize, err
+	}
+
+	return height * ratio, nil
+}
+
 /* ------------------------------ Exported Constructors ---------------------------- */
 
 // HeightPercentage creates a future that will resolve to a value that is a
 // percentage of the parent draw rect's height.
 func HeightPercentage(percentage Size) Future {
-	return newIncompleteFuture(heightPercentage, percentage)
+	future := newIncompleteFuture(heightPercentage, percentage)
+	future.relative = true
+	return future
 }
 
 // WidthPercentage creates a future that will resolve to a value that is a
 // percentage of the parent draw rect's width.
 func WidthPercentage(percentage Size) Future {
-	return newIncompleteFuture(widthPercentage, percentage)
+	future := newIncompleteFuture(widthPercentage, percentage)
+	future.relative = true
+	return future
 }
 
 // HeightAsChildren creates a future that will resolve to a value that is the
@@ -369,19 +783,160 @@ func WidthAsChildren() Future {
 
 // HeightFill creates a future that will resolve to whatever space is left
 // available within the draw rect of the parent after all sibling trees have
-// been resolved.
+// been resolved.  If several siblings fill, the space is shared equally
+// between them.
 func HeightFill() Future {
-	return newIncompleteFuture(heightFill, nil)
+	future := newIncompleteFuture(heightFill, nil)
+	future.fill = true
+	future.relative = true
+	return future
 }
 
 // WidthFill creates a future that will resolve to whatever space is left
 // available within the draw rect of the parent after all sibling trees have
-// been resolved.
+// been resolved.  If several siblings fill, the space is shared equally
+// between them.
 func WidthFill() Future {
-	return newIncompleteFuture(widthFill, nil)
+	future := newIncompleteFuture(widthFill, nil)
+	future.fill = true
+	future.relative = true
+	return future
+}
+
+// HeightFromAspectRatio creates a future that will resolve to the node's
+// width divided by the ratio, so that the node's render rect has the given
+// ratio of width to height (e.g. 16.0 / 9.0).
+func HeightFromAspectRatio(ratio Size) Future {
+	return newIncompleteFuture(heightFromAspectRatio, ratio)
+}
+
+// WidthFromAspectRatio creates a future that will resolve to the node's
+// height multiplied by the ratio, so that the node's render rect has the
+// given ratio of width to height (e.g. 16.0 / 9.0).
+func WidthFromAspectRatio(ratio Size) Future {
+	return newIncompleteFuture(widthFromAspectRatio, ratio)
+}
+
+// HeightFromImageRatio creates a future that will resolve to the height at
+// which the node's image fills its width without being distorted.  The future
+// can only be used on nodes created by the `Image` constructor.
+func HeightFromImageRatio() Future {
+	return newIncompleteFuture(heightFromAspectRatio, nil)
+}
+
+// WidthFromImageRatio creates a future that will resolve to the width at
+// which the node's image fills its height without being distorted.  The future
+// can only be used on nodes created by the `Image` constructor.
+func WidthFromImageRatio() Future {
+	return newIncompleteFuture(widthFromAspectRatio, nil)
 }
 
 // StaticSize returns a future that is already resolved to a static value.
 func StaticSize(size Size) Future {
 	return newCompleteFuture(size)
 }
+
+/* ------------------------------ Future Expressions ---------------------------- */
+
+type futureOperator int
+
+const (
+	operatorAdd futureOperator = iota
+	operatorSubtract
+	operatorMultiply
+	operatorMin
+	operatorMax
+)
+
+// futureExpression is the params of a future which combines the values of
+// other futures, similarly to `calc()` in CSS
+type futureExpression struct {
+	operator futureOperator
+	operands []Future
+	factor   Size
+}
+
+func evaluateExpression(node *LayoutNode, params interface{}) (Size, error) {
+	expression := params.(futureExpression)
+
+	values := make([]Size, len(expression.operands))
+	for idx := range expression.operands {
+		// the operands have been bound to the node that the expression
+		// belongs to, see `bind`
+		value, err := expression.operands[idx].await()
+		if err != nil {
+			return emptySize, err
+		}
+		values[idx] = value
+	}
+
+	result := values[0]
+	for _, value := range values[1:] {
+		switch expression.operator {
+		case operatorAdd:
+			result += value
+		case operatorSubtract:
+			result -= value
+		case operatorMin:
+			result = math.Min(result, value)
+		case operatorMax:
+			result = math.Max(result, value)
+		}
+	}
+
+	if expression.operator == operatorMultiply {
+		result *= expression.factor
+	}
+
+	return result, nil
+}
+
+// newExpressionFuture creates a future which evaluates the expression once it
+// is awaited.  The expression is relative to the parent if any of its operands
+// are, and shares the free space in the parent with the node's siblings if any
+// of its operands are fills, in which case the expression is applied to the
+// node's share of the free space.
+func newExpressionFuture(operator futureOperator, factor Size, operands ...Future) Future {
+	future := newIncompleteFuture(evaluateExpression, futureExpression{operator, operands, factor})
+	for _, operand := range operands {
+		future.relative = future.relative || operand.relative
+		future.fill = future.fill || operand.fill
+	}
+	return future
+}
+
+// Plus creates a future that will resolve to the sum of the two futures
+func (f Future) Plus(other Future) Future {
+	return newExpressionFuture(operatorAdd, 0, f, other)
+}
+
+// Minus creates a future that will resolve to the value of the other future
+// subtracted from the value of this one
+func (f Future) Minus(other Future) Future {
+	return newExpressionFuture(operatorSubtract, 0, f, other)
+}
+
+// Times creates a future that will resolve to the value of the future
+// multiplied by a factor
+func (f Future) Times(factor Size) Future {
+	return newExpressionFuture(operatorMultiply, factor, f)
+}
+
+// Min creates a future that will resolve to the smaller of the values of the
+// two futures
+func (f Future) Min(other Future) Future {
+	return newExpressionFuture(operatorMin, 0, f, other)
+}
+
+// Max creates a future that will resolve to the larger of the values of the
+// two futures
+func (f Future) Max(other Future) Future {
+	return newExpressionFuture(operatorMax, 0, f, other)
+}
+
+// Clamp creates a future that will resolve to the value of the future, but no
+// smaller than min and no larger than max.  As with `Min` and `Max`, min wins
+// if the two conflict.
+func (f Future) Clamp(min, max Future) Future {
+	return f.Min(max).Max(min)
+}
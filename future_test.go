@@ -0,0 +1,562 @@
+package docspec
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// rowWidths lays out a row filling the width of the page, with a child for
+// each of the given props, and returns the widths of the children
+func rowWidths(t *testing.T, row LayoutNodeProps, children ...LayoutNodeProps) []Size {
+	t.Helper()
+
+	row.ID = "row"
+	row.Width = WidthFill()
+	row.Height = StaticSize(10)
+	row.ChildFlowDirection = FlowHorizontal
+	node := Div(nil, row, func(parent *LayoutNode) {
+		for _, props := range children {
+			if props.Height.isUnitialized() {
+				props.Height = HeightFill()
+			}
+			Div(parent, props, NoChildren)
+		}
+	})
+	layoutNodes(t, node)
+
+	widths := make([]Size, len(node.Children))
+	for idx, child := range node.Children {
+		widths[idx] = rectOf(t, child).width
+	}
+	return widths
+}
+
+func assertSizes(t *testing.T, expected []Size, actual []Size) {
+	t.Helper()
+
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	for idx := range expected {
+		if !sizesEqual(expected[idx], actual[idx]) {
+			t.Fatalf("expected %v, got %v", expected, actual)
+		}
+	}
+}
+
+func TestSizeExpressions(t *testing.T) {
+	tests := []struct {
+		name     string
+		children []LayoutNodeProps
+		expected []Size
+	}{
+		{
+			name: "arithmetic on static sizes and percentages",
+			children: []LayoutNodeProps{
+				{Width: StaticSize(20).Plus(StaticSize(5))},
+				{Width: WidthPercentage(50).Minus(StaticSize(10))},
+				{Width: StaticSize(10).Times(3)},
+			},
+			expected: []Size{25, 87.95, 30},
+		},
+		{
+			name: "min, max and clamp",
+			children: []LayoutNodeProps{
+				{Width: WidthPercentage(50).Min(StaticSize(40))},
+				{Width: StaticSize(10).Max(StaticSize(20))},
+				{Width: WidthPercentage(100).Clamp(StaticSize(10), StaticSize(30))},
+			},
+			expected: []Size{40, 20, 30},
+		},
+		{
+			name: "expression of a fill applies to the fill's share",
+			children: []LayoutNodeProps{
+				{Width: StaticSize(50.9)},
+				{Width: WidthFill().Minus(StaticSize(10))},
+			},
+			expected: []Size{50.9, 135},
+		},
+		{
+			name: "siblings with expressions of fills share the free space",
+			children: []LayoutNodeProps{
+				{ID: "a", Width: WidthFill().Minus(StaticSize(10))},
+				{ID: "b", Width: StaticSize(45.9)},
+				{ID: "c", Width: WidthFill().Max(StaticSize(60))},
+			},
+			expected: []Size{65, 45.9, 75},
+		},
+		{
+			name: "expression of a fill shares the free space with plain fills",
+			children: []LayoutNodeProps{
+				{Width: WidthFill().Times(0.5)},
+				{Width: WidthFill()},
+				{Width: StaticSize(15.9)},
+			},
+			expected: []Size{45, 90, 15.9},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assertSizes(t, test.expected, rowWidths(t, LayoutNodeProps{}, test.children...))
+		})
+	}
+}
+
+func TestExpressionOperandsAreBound(t *testing.T) {
+	calls := 0
+	operand := newIncompleteFuture(func(node *LayoutNode, params interface{}) (Size, error) {
+		calls++
+		return 10, nil
+	}, nil)
+	node := Div(nil, LayoutNodeProps{Width: operand.Plus(StaticSize(5)), Height: StaticSize(10)}, NoChildren)
+
+	operands := node.Width.params.(futureExpression).operands
+	if operands[0].node != node || operands[0].property != "Width[0]" {
+		t.Fatalf("expected the operand to be bound to the node's Width[0], got %s", operands[0].describe())
+	}
+
+	steps := []struct {
+		name       string
+		invalidate bool
+		calls      int
+	}{
+		{name: "resolved when first awaited", calls: 1},
+		{name: "cached once resolved", calls: 1},
+		{name: "resolved again once the node is invalidated", invalidate: true, calls: 2},
+	}
+
+	for _, step := range steps {
+		if step.invalidate {
+			node.invalidateSizes()
+		}
+
+		// await the operand through a copy of the expression, as the
+		// expression itself is cached
+		expression := node.Width
+		expression.state = futureIncomplete
+		width, err := expression.await()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if width != 15 || calls != step.calls {
+			t.Errorf("%s: expected 15 after %d calls, got %f after %d calls", step.name, step.calls, width, calls)
+		}
+	}
+
+	// a copy of the node resolves its own operands
+	clone := node.Clone()
+	if operand := clone.Width.params.(futureExpression).operands[0]; operand.node != clone {
+		t.Errorf("expected the operand of the clone to be bound to the clone, got %s", operand.describe())
+	}
+}
+
+func TestRichTextHeight(t *testing.T) {
+	tests := []struct {
+		name     string
+		richText RichTextNode
+		expected Size
+	}{
+		{
+			name:     "empty paragraph is one line of its base font",
+			richText: RichTextNode{FontSize: 12, LineHeight: 1.5},
+			expected: 12 * 0.3528 * 1.5,
+		},
+		{
+			name:     "single span",
+			richText: RichTextNode{Spans: []TextSpan{{Text: "Hello", FontFamily: "Inter", FontSize: 10}}},
+			expected: 10 * 0.3528,
+		},
+		{
+			name: "line is as tall as its largest font",
+			richText: RichTextNode{Spans: []TextSpan{
+				{Text: "Hello, ", FontFamily: "Inter", FontSize: 10},
+				{Text: "World", FontFamily: "Inter", FontStyle: FontBold, FontSize: 20},
+			}},
+			expected: 20 * 0.3528,
+		},
+		{
+			name: "each line is measured on its own",
+			richText: RichTextNode{Spans: []TextSpan{
+				{Text: "Hello,\n", FontFamily: "Inter", FontSize: 10},
+				{Text: "World", FontFamily: "Inter", FontSize: 20},
+			}},
+			expected: 10*0.3528 + 20*0.3528,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node := RichText(nil, LayoutNodeProps{Width: WidthFill(), Height: HeightAsChildren(), Padding: NewSingletonSizeQuad(2)}, test.richText)
+			layoutNodes(t, node)
+
+			actual := rectOf(t, node).height
+			if !sizesEqual(actual, test.expected+4) {
+				t.Errorf("expected a height of %f, got %f", test.expected+4, actual)
+			}
+		})
+	}
+}
+
+func TestFlexFactors(t *testing.T) {
+	tests := []struct {
+		name     string
+		children []LayoutNodeProps
+		expected []Size
+	}{
+		{
+			name: "equal grow factors share the free space equally",
+			children: []LayoutNodeProps{
+				{FlexGrow: 1},
+				{FlexGrow: 1},
+				{Width: StaticSize(45.9)},
+			},
+			expected: []Size{75, 75, 45.9},
+		},
+		{
+			name: "free space is shared in proportion to the grow factors",
+			children: []LayoutNodeProps{
+				{FlexGrow: 1},
+				{FlexGrow: 2},
+				{Width: StaticSize(45.9)},
+			},
+			expected: []Size{50, 100, 45.9},
+		},
+		{
+			name: "nodes grow from their basis",
+			children: []LayoutNodeProps{
+				{FlexGrow: 1, FlexBasis: StaticSize(20)},
+				{FlexGrow: 1, FlexBasis: StaticSize(40)},
+				{Width: StaticSize(45.9)},
+			},
+			expected: []Size{65, 85, 45.9},
+		},
+		{
+			name: "width is the basis if there isn't one",
+			children: []LayoutNodeProps{
+				{FlexGrow: 1, Width: StaticSize(20)},
+				{FlexGrow: 1, Width: StaticSize(40)},
+				{Width: StaticSize(45.9)},
+			},
+			expected: []Size{65, 85, 45.9},
+		},
+		{
+			name: "plain fills grow like a grow factor of 1",
+			children: []LayoutNodeProps{
+				{Width: WidthFill()},
+				{FlexGrow: 1},
+				{Width: StaticSize(45.9)},
+			},
+			expected: []Size{75, 75, 45.9},
+		},
+		{
+			name: "nodes without a grow factor keep their basis",
+			children: []LayoutNodeProps{
+				{FlexBasis: StaticSize(30)},
+				{Width: WidthFill()},
+				{Width: StaticSize(45.9)},
+			},
+			expected: []Size{30, 120, 45.9},
+		},
+		{
+			name: "overflow is taken from the nodes in proportion to their shrink factors and basis",
+			children: []LayoutNodeProps{
+				{FlexShrink: 1, FlexBasis: StaticSize(150)},
+				{FlexShrink: 1, FlexBasis: StaticSize(50)},
+				{Width: StaticSize(45.9)},
+			},
+			expected: []Size{112.5, 37.5, 45.9},
+		},
+		{
+			name: "nodes without a shrink factor don't shrink",
+			children: []LayoutNodeProps{
+				{FlexShrink: 1, FlexBasis: StaticSize(100)},
+				{FlexBasis: StaticSize(100)},
+				{Width: StaticSize(45.9)},
+			},
+			expected: []Size{50, 100, 45.9},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assertSizes(t, test.expected, rowWidths(t, LayoutNodeProps{}, test.children...))
+		})
+	}
+}
+
+func TestFlexFactorsInColumn(t *testing.T) {
+	column := Div(nil, LayoutNodeProps{Width: WidthFill(), Height: StaticSize(100)}, func(parent *LayoutNode) {
+		Div(parent, LayoutNodeProps{Width: WidthFill(), FlexGrow: 1, FlexBasis: StaticSize(10)}, NoChildren)
+		Div(parent, LayoutNodeProps{Width: WidthFill(), FlexGrow: 3, Height: StaticSize(30)}, NoChildren)
+	})
+	layoutNodes(t, column)
+
+	heights := []Size{rectOf(t, column.Children[0]).height, rectOf(t, column.Children[1]).height}
+	assertSizes(t, []Size{25, 75}, heights)
+}
+
+func TestFlexFactorsAtTopLevel(t *testing.T) {
+	w := Size(195.9)
+	flex := func(props LayoutNodeProps) *LayoutNode {
+		props.Width = WidthFill()
+		return Div(nil, props, NoChildren)
+	}
+
+	tests := []struct {
+		name     string
+		nodes    []*LayoutNode
+		expected [][]testRect
+	}{
+		{
+			"grows into the space left below the nodes before it",
+			[]*LayoutNode{box(100, LayoutNodeProps{}), flex(LayoutNodeProps{FlexGrow: 1, FlexBasis: StaticSize(50)})},
+			[][]testRect{{{10, 10, w, 100}, {10, 110, w, 159.4}}},
+		},
+		{
+			"keeps its basis without a grow factor",
+			[]*LayoutNode{box(100, LayoutNodeProps{}), flex(LayoutNodeProps{FlexBasis: StaticSize(50)})},
+			[][]testRect{{{10, 10, w, 100}, {10, 110, w, 50}}},
+		},
+		{
+			"shrinks into the space left below the nodes before it",
+			[]*LayoutNode{box(100, LayoutNodeProps{}), flex(LayoutNodeProps{FlexShrink: 1, FlexBasis: StaticSize(200)})},
+			[][]testRect{{{10, 10, w, 100}, {10, 110, w, 159.4}}},
+		},
+		{
+			"does not share the space with the nodes after it",
+			[]*LayoutNode{
+				box(100, LayoutNodeProps{}),
+				flex(LayoutNodeProps{FlexGrow: 1, FlexBasis: StaticSize(50)}),
+				flex(LayoutNodeProps{FlexGrow: 1, FlexBasis: StaticSize(50)}),
+			},
+			[][]testRect{{{10, 10, w, 100}, {10, 110, w, 159.4}}, {{10, 10, w, 259.4}}},
+		},
+		{
+			"fills the whole page when it comes first",
+			[]*LayoutNode{flex(LayoutNodeProps{FlexGrow: 1, FlexBasis: StaticSize(50)}), box(100, LayoutNodeProps{})},
+			[][]testRect{{{10, 10, w, 259.4}}, {{10, 10, w, 100}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assertPageRects(t, layoutNodes(t, test.nodes...), test.expected)
+		})
+	}
+}
+
+func TestMinMaxSizes(t *testing.T) {
+	tests := []struct {
+		name     string
+		children []LayoutNodeProps
+		expected []Size
+	}{
+		{
+			name: "static sizes are clamped",
+			children: []LayoutNodeProps{
+				{Width: StaticSize(50), MaxWidth: 30},
+				{Width: StaticSize(10), MinWidth: 20},
+				{Width: StaticSize(10), MaxWidth: 0},
+			},
+			expected: []Size{30, 20, 10},
+		},
+		{
+			name: "percentages are clamped",
+			children: []LayoutNodeProps{
+				{Width: WidthPercentage(50), MaxWidth: 40},
+				{Width: WidthPercentage(10), MinWidth: 40},
+			},
+			expected: []Size{40, 40},
+		},
+		{
+			name: "free space left by a fill clamped to its max goes to the other fills",
+			children: []LayoutNodeProps{
+				{Width: WidthFill(), MaxWidth: 50},
+				{Width: WidthFill()},
+			},
+			expected: []Size{50, 145.9},
+		},
+		{
+			name: "fill clamped to its min takes space from the other fills",
+			children: []LayoutNodeProps{
+				{Width: WidthFill(), MinWidth: 150},
+				{Width: WidthFill()},
+				{Width: WidthFill()},
+			},
+			expected: []Size{150, 22.95, 22.95},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assertSizes(t, test.expected, rowWidths(t, LayoutNodeProps{}, test.children...))
+		})
+	}
+}
+
+func TestMinMaxHeights(t *testing.T) {
+	document := layoutNodes(t,
+		column(LayoutNodeProps{MaxHeight: 25}, 10, 10, 10),
+		column(LayoutNodeProps{MinHeight: 30}, 10),
+		Div(nil, LayoutNodeProps{Width: WidthFill(), Height: HeightFill(), MaxHeight: 50}, NoChildren),
+	)
+
+	assertPageRects(t, document, [][]testRect{{
+		{10, 10, 195.9, 25},
+		{10, 35, 195.9, 30},
+		{10, 65, 195.9, 50},
+	}})
+}
+
+// testImage writes a PNG of the given size in pixels
+func testImage(t *testing.T, width, height int) string {
+	t.Helper()
+
+	file, err := os.Create(filepath.Join(t.TempDir(), "image.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	err = png.Encode(file, image.NewGray(image.Rect(0, 0, width, height)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file.Name()
+}
+
+func TestAspectRatios(t *testing.T) {
+	tests := []struct {
+		name     string
+		node     func(t *testing.T) *LayoutNode
+		expected testRect
+	}{
+		{
+			name: "height from the width",
+			node: func(t *testing.T) *LayoutNode {
+				return Div(nil, LayoutNodeProps{Width: StaticSize(100), Height: HeightFromAspectRatio(2)}, NoChildren)
+			},
+			expected: testRect{10, 10, 100, 50},
+		},
+		{
+			name: "width from the height",
+			node: func(t *testing.T) *LayoutNode {
+				return Div(nil, LayoutNodeProps{Width: WidthFromAspectRatio(0.5), Height: StaticSize(40)}, NoChildren)
+			},
+			expected: testRect{10, 10, 20, 40},
+		},
+		{
+			name: "height from a fill",
+			node: func(t *testing.T) *LayoutNode {
+				return Div(nil, LayoutNodeProps{Width: WidthFill(), Height: HeightFromAspectRatio(16.0 / 9.0)}, NoChildren)
+			},
+			expected: testRect{10, 10, 195.9, 195.9 * 9 / 16},
+		},
+		{
+			name: "ratio applies to the render rect, including the padding",
+			node: func(t *testing.T) *LayoutNode {
+				return Div(nil, LayoutNodeProps{Width: StaticSize(100), Height: HeightFromAspectRatio(2), Padding: NewSingletonSizeQuad(5)}, NoChildren)
+			},
+			expected: testRect{10, 10, 100, 50},
+		},
+		{
+			name: "height from the ratio of an image, excluding the padding",
+			node: func(t *testing.T) *LayoutNode {
+				return Image(nil, LayoutNodeProps{Width: StaticSize(100), Height: HeightFromImageRatio(), Padding: NewSingletonSizeQuad(5)}, ImageNode{Src: testImage(t, 40, 20)})
+			},
+			expected: testRect{10, 10, 100, 55},
+		},
+		{
+			name: "width from the ratio of an image, excluding the padding",
+			node: func(t *testing.T) *LayoutNode {
+				return Image(nil, LayoutNodeProps{Width: WidthFromImageRatio(), Height: StaticSize(50), Padding: NewSingletonSizeQuad(5)}, ImageNode{Src: testImage(t, 40, 20)})
+			},
+			expected: testRect{10, 10, 90, 50},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assertPageRects(t, layoutNodes(t, test.node(t)), [][]testRect{{test.expected}})
+		})
+	}
+}
+
+func TestFutureCache(t *testing.T) {
+	node := Div(nil, LayoutNodeProps{Width: StaticSize(10), Height: StaticSize(10)}, NoChildren)
+
+	calls := 0
+	future := newIncompleteFuture(func(node *LayoutNode, params interface{}) (Size, error) {
+		calls++
+		return Size(calls), nil
+	}, nil)
+	future.node = node
+
+	steps := []struct {
+		name       string
+		invalidate bool
+		value      Size
+		calls      int
+	}{
+		{name: "resolved when first awaited", value: 1, calls: 1},
+		{name: "cached when awaited again", value: 1, calls: 1},
+		{name: "resolved again once invalidated", invalidate: true, value: 2, calls: 2},
+		{name: "cached again", value: 2, calls: 2},
+	}
+
+	for _, step := range steps {
+		if step.invalidate {
+			future.invalidate()
+		}
+
+		value, err := future.await()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != step.value || calls != step.calls {
+			t.Errorf("%s: expected %f after %d calls, got %f after %d calls", step.name, step.value, step.calls, value, calls)
+		}
+	}
+
+	// static sizes are never thrown away
+	node.Width.invalidate()
+	if width, _ := node.Width.await(); width != 10 {
+		t.Errorf("expected the static width to be kept, got %f", width)
+	}
+}
+
+func TestLayoutAfterTreeChanges(t *testing.T) {
+	node := column(LayoutNodeProps{}, 10, 10)
+	builder := newTestBuilder(t)
+	err := builder.CreateDocumentTree([]*LayoutNode{node})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertPageRects(t, builder.document, [][]testRect{{{10, 10, 195.9, 20}}})
+
+	// sizes that were resolved for the old tree are thrown away
+	Div(node, LayoutNodeProps{Width: WidthFill(), Height: StaticSize(30)}, NoChildren)
+	builder = newTestBuilder(t)
+	err = builder.CreateDocumentTree([]*LayoutNode{node})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertPageRects(t, builder.document, [][]testRect{{{10, 10, 195.9, 50}}})
+}
+
+func TestColumnLayoutScaling(t *testing.T) {
+	// the children are thin enough for the largest column to fit on a page
+	assertLinearScaling(t, 500, func(size int) *LayoutNode {
+		return Div(nil, LayoutNodeProps{Width: WidthFill(), Height: HeightAsChildren()}, func(parent *LayoutNode) {
+			for idx := 0; idx < size; idx++ {
+				Div(parent, LayoutNodeProps{Width: WidthFill(), Height: HeightAsChildren()}, func(parent *LayoutNode) {
+					Div(parent, LayoutNodeProps{Width: WidthFill(), Height: StaticSize(0.1)}, NoChildren)
+				})
+			}
+		})
+	})
+}
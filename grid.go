@@ -0,0 +1,586 @@
+package docspec
+
+import (
+	"errors"
+	"math"
+)
+
+/*
+Grids lay out their children into the cells formed by a list of column
+tracks and a list of row tracks, similarly to CSS grid.  Each child occupies an
+"area" of one or more cells, either placed explicitly via the GridColumn and
+GridRow props, or automatically in the next free area, going across each row
+from left to right.  Rows beyond the ones defined in GridProps are created as
+needed, and are sized as `TrackAuto`.
+
+Children are sized relative to their area rather than to the grid itself, so a
+child with `WidthFill`/`HeightFill` fills its area, and percentages are
+percentages of the area.
+*/
+
+type gridTrackKind int
+
+const (
+	gridTrackStatic gridTrackKind = iota
+	gridTrackPercentage
+	gridTrackFraction
+	gridTrackAuto
+)
+
+// GridTrack defines the size of a single column or row of a grid
+type GridTrack struct {
+	kind  gridTrackKind
+	value Size
+}
+
+// TrackStatic creates a track with a static size
+func TrackStatic(size Size) GridTrack {
+	return GridTrack{gridTrackStatic, size}
+}
+
+// TrackPercentage creates a track sized as a percentage of the grid's draw
+// rect
+func TrackPercentage(percentage Size) GridTrack {
+	return GridTrack{gridTrackPercentage, percentage}
+}
+
+// TrackFraction creates a track which takes a share of the space left over
+// after all other tracks have been sized, in proportion to its fraction
+// compared to the other fraction tracks (like `fr` in CSS)
+func TrackFraction(fraction Size) GridTrack {
+	return GridTrack{gridTrackFraction, fraction}
+}
+
+// TrackAuto creates a track sized to fit the largest child placed in it
+func TrackAuto() GridTrack {
+	return GridTrack{gridTrackAuto, emptySize}
+}
+
+// GridProps defines the tracks of a grid
+type GridProps struct {
+	Columns []GridTrack
+	Rows    []GridTrack
+}
+
+// Grid inserts a grid layout node into the document tree.  Children created in
+// the callback are placed into the grid's cells in order, unless they specify
+// their own position with the grid props in LayoutNodeProps.
+func Grid(parent *LayoutNode, options LayoutNodeProps, grid GridProps, cb func(*LayoutNode)) *LayoutNode {
+	gridProps := grid
+	newNode := &LayoutNode{
+		Parent:   parent,
+		Page:     nil,
+		Children: make([]*LayoutNode, 0),
+		grid:     &gridProps,
+	}
+	newNode.mergeProps(options)
+	newNode.bindFutures()
+
+	cb(newNode)
+
+	if parent != nil {
+		parent.Children = append(parent.Children, newNode)
+	}
+
+	return newNode
+}
+
+// gridArea is the zero-based position and span of a child in a grid
+type gridArea struct {
+	column     int
+	row        int
+	columnSpan int
+	rowSpan    int
+}
+
+// start and span of the area along the given axis, where the horizontal axis
+// is the columns and the vertical axis is the rows
+func (a gridArea) along(axis childFlowDirection) (int, int) {
+	if axis == FlowHorizontal {
+		return a.column, a.columnSpan
+	}
+	return a.row, a.rowSpan
+}
+
+// columnCount returns the number of columns in the grid, which is always at
+// least one.
+func (n *LayoutNode) columnCount() int {
+	if len(n.grid.Columns) == 0 {
+		return 1
+	}
+	return len(n.grid.Columns)
+}
+
+// requestedGridArea returns the area requested by the node's grid props,
+// clamped to the number of columns in the grid.  The row or column is -1 if
+// the node should be placed automatically along that axis.
+func (n *LayoutNode) requestedGridArea(columns int) gridArea {
+	area := gridArea{
+		column:     n.GridColumn - 1,
+		row:        n.GridRow - 1,
+		columnSpan: n.GridColumnSpan,
+		rowSpan:    n.GridRowSpan,
+	}
+
+	if area.columnSpan < 1 {
+		area.columnSpan = 1
+	}
+	if area.columnSpan > columns {
+		area.columnSpan = columns
+	}
+	if area.rowSpan < 1 {
+		area.rowSpan = 1
+	}
+	if area.column+area.columnSpan > columns {
+		area.column = columns - area.columnSpan
+	}
+
+	return area
+}
+
+// gridLayout is the placement of a grid's children, along with the sizes of
+// its tracks once they have been resolved
+type gridLayout struct {
+	areas    []gridArea
+	rowCount int
+	// index of each child in the normal flow, for looking up its area
+	index  map[*LayoutNode]int
+	tracks map[gridTracksKey]gridTracks
+}
+
+// gridTracksKey identifies one of the ways of sizing a grid's tracks
+type gridTracksKey struct {
+	axis     childFlowDirection
+	definite bool
+}
+
+// gridTracks are the sizes of the tracks along an axis, and the offset of
+// each track from the start of the grid's draw rect
+type gridTracks struct {
+	sizes   []Size
+	offsets []Size
+}
+
+// cachedGridLayout returns the layout of the grid for the current layout
+// pass, placing the children into their areas the first time it is needed.
+// Every child's size depends on its area, so working the layout out again for
+// each child would make grids quadratic in their number of children.
+func (n *LayoutNode) cachedGridLayout() *gridLayout {
+	if n.gridLayout == nil {
+		areas, rowCount := n.placeGridChildren()
+		index := make(map[*LayoutNode]int, len(areas))
+		for idx, child := range n.flowChildren() {
+			index[child] = idx
+		}
+
+		n.gridLayout = &gridLayout{
+			areas:    areas,
+			rowCount: rowCount,
+			index:    index,
+			tracks:   make(map[gridTracksKey]gridTracks),
+		}
+	}
+
+	return n.gridLayout
+}
+
+// gridAreas returns the area of each child of a grid, in the same order as
+// the children in the normal flow, along with the total number of rows.
+func (n *LayoutNode) gridAreas() ([]gridArea, int) {
+	layout := n.cachedGridLayout()
+	return layout.areas, layout.rowCount
+}
+
+// placeGridChildren places each child of a grid into an area, and returns the
+// areas in the same order as the children in the normal flow, along with the
+// total number of rows.
+func (n *LayoutNode) placeGridChildren() ([]gridArea, int) {
+	children := n.flowChildren()
+	columns := n.columnCount()
+	areas := make([]gridArea, len(children))
+	occupied := make(map[[2]int]bool)
+
+	fits := func(a gridArea) bool {
+		if a.column+a.columnSpan > columns {
+			return false
+		}
+		for row := a.row; row < a.row+a.rowSpan; row++ {
+			for column := a.column; column < a.column+a.columnSpan; column++ {
+				if occupied[[2]int{row, column}] {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	rowCount := len(n.grid.Rows)
+
+	place := func(idx int, area gridArea) {
+		for row := area.row; row < area.row+area.rowSpan; row++ {
+			for column := area.column; column < area.column+area.columnSpan; column++ {
+				occupied[[2]int{row, column}] = true
+			}
+		}
+
+		if area.row+area.rowSpan > rowCount {
+			rowCount = area.row + area.rowSpan
+		}
+
+		areas[idx] = area
+	}
+
+	// as in CSS, children with an explicit cell are placed first, even if
+	// they overlap each other, and the rest of the children flow around them
+	for idx, child := range children {
+		area := child.requestedGridArea(columns)
+		if area.column >= 0 && area.row >= 0 {
+			place(idx, area)
+		}
+	}
+
+	// the position after the last automatically placed child, so that
+	// automatic placement always moves forwards through the grid
+	cursorRow := 0
+	cursorColumn := 0
+
+	for idx, child := range children {
+		area := child.requestedGridArea(columns)
+
+		switch {
+		case area.column >= 0 && area.row >= 0:
+			continue
+		case area.row >= 0:
+			// find the first column in the row that fits
+			for area.column = 0; !fits(area) && area.column+area.columnSpan < columns; area.column++ {
+			}
+		case area.column >= 0:
+			// find the first row in the column that fits
+			for area.row = 0; !fits(area); area.row++ {
+			}
+		default:
+			area.row, area.column = cursorRow, cursorColumn
+			for !fits(area) {
+				area.column++
+				if area.column+area.columnSpan > columns {
+					area.column = 0
+					area.row++
+				}
+			}
+			cursorRow = area.row
+			cursorColumn = area.column + area.columnSpan
+		}
+
+		place(idx, area)
+	}
+
+	return areas, rowCount
+}
+
+// gridTrackSizes returns the size of every column (for the horizontal axis)
+// or row (for the vertical axis) of the grid.  If the size of the grid along
+// the axis is not definite, because the grid is being sized as its children,
+// percentage and fraction tracks are sized like auto tracks.
+func (n *LayoutNode) gridTrackSizes(axis childFlowDirection, definite bool) ([]Size, error) {
+	tracks, err := n.cachedGridTracks(axis, definite)
+	return tracks.sizes, err
+}
+
+// cachedGridTracks returns the grid's tracks along an axis for the current
+// layout pass, resolving them the first time they are needed.
+func (n *LayoutNode) cachedGridTracks(axis childFlowDirection, definite bool) (gridTracks, error) {
+	layout := n.cachedGridLayout()
+	key := gridTracksKey{axis, definite}
+	if tracks, ok := layout.tracks[key]; ok {
+		return tracks, nil
+	}
+
+	sizes, err := n.resolveGridTrackSizes(axis, definite)
+	if err != nil {
+		return gridTracks{}, err
+	}
+
+	gap := n.gapAlong(axis)
+	offsets := make([]Size, len(sizes))
+	offset := emptySize
+	for idx, size := range sizes {
+		offsets[idx] = offset
+		offset += size + gap
+	}
+
+	tracks := gridTracks{sizes, offsets}
+	layout.tracks[key] = tracks
+	return tracks, nil
+}
+
+// resolveGridTrackSizes works out the size of every track along an axis,
+// as described by gridTrackSizes.
+func (n *LayoutNode) resolveGridTrackSizes(axis childFlowDirection, definite bool) ([]Size, error) {
+	areas, rowCount := n.gridAreas()
+
+	tracks := n.grid.Rows
+	count := rowCount
+	if axis == FlowHorizontal {
+		tracks = n.grid.Columns
+		count = n.columnCount()
+	}
+
+	available := emptySize
+	if definite {
+		var err error
+		if axis == FlowHorizontal {
+			available, err = n.getDrawWidth()
+		} else {
+			available, err = n.getDrawHeight()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	kinds := make([]gridTrackKind, count)
+	sizes := make([]Size, count)
+	totalFraction := emptySize
+
+	for idx := range sizes {
+		track := TrackAuto()
+		if idx < len(tracks) {
+			track = tracks[idx]
+		}
+
+		kind := track.kind
+		if !definite && (kind == gridTrackPercentage || kind == gridTrackFraction) {
+			kind = gridTrackAuto
+		}
+		kinds[idx] = kind
+
+		switch kind {
+		case gridTrackStatic:
+			sizes[idx] = track.value
+		case gridTrackPercentage:
+			sizes[idx] = available * (track.value / 100)
+		case gridTrackFraction:
+			totalFraction += track.value
+		}
+	}
+
+	// auto tracks are sized by their children, first by the children that
+	// only span a single track, and then by growing the auto tracks spanned
+	// by any child that still doesn't fit
+	for _, singleSpan := range []bool{true, false} {
+		for idx, child := range n.flowChildren() {
+			start, span := areas[idx].along(axis)
+			if (span == 1) != singleSpan {
+				continue
+			}
+
+			spanned := totalGap(n.gapAlong(axis), span)
+			autoTracks := make([]int, 0)
+			for track := start; track < start+span; track++ {
+				spanned += sizes[track]
+				if kinds[track] == gridTrackAuto {
+					autoTracks = append(autoTracks, track)
+				}
+			}
+			if len(autoTracks) == 0 {
+				continue
+			}
+
+			size, measurable, err := gridIntrinsicSize(child, axis)
+			if err != nil {
+				return nil, err
+			}
+
+			if measurable && size > spanned {
+				extra := (size - spanned) / float64(len(autoTracks))
+				for _, track := range autoTracks {
+					sizes[track] += extra
+				}
+			}
+		}
+	}
+
+	if totalFraction > 0 {
+		free := available - totalGap(n.gapAlong(axis), count)
+		for idx, size := range sizes {
+			if kinds[idx] != gridTrackFraction {
+				free -= size
+			}
+		}
+
+		if free > 0 {
+			for idx := range sizes {
+				if kinds[idx] == gridTrackFraction {
+					sizes[idx] = free * (tracks[idx].value / totalFraction)
+				}
+			}
+		}
+	}
+
+	return sizes, nil
+}
+
+// gridIntrinsicSize measures the bounding size of a grid child along an axis
+// for the purpose of sizing auto tracks.  As in CSS, children that are sized
+// relative to their area are measured by the size of their content instead.
+// If that content is itself sized relative to the area, the child can't be
+// measured (nor can content without an inherent size, such as an image), and
+// doesn't contribute to the size of its tracks.
+func gridIntrinsicSize(child *LayoutNode, axis childFlowDirection) (Size, bool, error) {
+	if axis == FlowHorizontal && !child.Width.relative {
+		size, err := child.getBoundingWidth()
+		return size, true, err
+	}
+
+	if axis == FlowVertical && !child.Height.relative {
+		size, err := child.getBoundingHeight()
+		return size, true, err
+	}
+
+	var size Size
+	var err error
+	if axis == FlowHorizontal {
+		size, err = widthAsChildren(child, nil)
+	} else {
+		size, err = heightAsChildren(child, nil)
+	}
+
+	var cycle *CycleError
+	var unsupported *UnsupportedVisualNodeError
+	if errors.As(err, &cycle) || errors.As(err, &unsupported) {
+		return emptySize, false, nil
+	}
+	if err != nil {
+		return emptySize, false, err
+	}
+
+	if axis == FlowHorizontal {
+		return child.clampSize(axis, size) + child.Margin.left + child.Margin.right, true, nil
+	}
+	return child.clampSize(axis, size) + child.Margin.top + child.Margin.bottom, true, nil
+}
+
+// gridContentSize is the size of all of the grid's tracks along an axis, used
+// when the grid is sized as its children.
+func (n *LayoutNode) gridContentSize(axis childFlowDirection) (Size, error) {
+	sizes, err := n.gridTrackSizes(axis, false)
+	if err != nil {
+		return emptySize, err
+	}
+
+	total := totalGap(n.gapAlong(axis), len(sizes))
+	for _, size := range sizes {
+		total += size
+	}
+	return total, nil
+}
+
+// gridCellRect returns the offset from the top left of the grid's draw rect and
+// the size of the area occupied by the child
+func (n *LayoutNode) gridCellRect(child *LayoutNode) (resolverCursor, Rect, error) {
+	x, width, err := n.gridCellSpan(child, FlowHorizontal)
+	if err != nil {
+		return resolverCursor{}, Rect{}, err
+	}
+
+	y, height, err := n.gridCellSpan(child, FlowVertical)
+	if err != nil {
+		return resolverCursor{}, Rect{}, err
+	}
+
+	return resolverCursor{x, y}, Rect{width, height}, nil
+}
+
+// gridCellSpan returns the offset from the start of the grid's draw rect and
+// the size of the area occupied by the child along a single axis.  The axes
+// are resolved separately, since the rows are often sized by children whose
+// height depends on the width of their column.
+func (n *LayoutNode) gridCellSpan(child *LayoutNode, axis childFlowDirection) (Size, Size, error) {
+	layout := n.cachedGridLayout()
+
+	var area gridArea
+	if idx, ok := layout.index[child]; ok {
+		area = layout.areas[idx]
+	}
+
+	tracks, err := n.cachedGridTracks(axis, true)
+	if err != nil {
+		return emptySize, emptySize, err
+	}
+
+	start, span := area.along(axis)
+
+	offset := emptySize
+	if start < len(tracks.offsets) {
+		offset = tracks.offsets[start]
+	}
+
+	size := totalGap(n.gapAlong(axis), span)
+	for idx := start; idx < start+span && idx < len(tracks.sizes); idx++ {
+		size += tracks.sizes[idx]
+	}
+
+	return offset, size, nil
+}
+
+// staticGridProps returns the grid's tracks with every track replaced by its
+// resolved static size, including the implicit rows.
+func (n *LayoutNode) staticGridProps() (*GridProps, error) {
+	columns, err := n.gridTrackSizes(FlowHorizontal, true)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := n.gridTrackSizes(FlowVertical, true)
+	if err != nil {
+		return nil, err
+	}
+
+	static := &GridProps{
+		Columns: make([]GridTrack, len(columns)),
+		Rows:    make([]GridTrack, len(rows)),
+	}
+	for idx, size := range columns {
+		static.Columns[idx] = TrackStatic(size)
+	}
+	for idx, size := range rows {
+		static.Rows[idx] = TrackStatic(size)
+	}
+
+	return static, nil
+}
+
+// gridFill resolves a fill inside a grid, which takes up the whole of the
+// node's area, less its margins.
+func gridFill(node *LayoutNode, axis childFlowDirection) (Size, error) {
+	_, size, err := node.Parent.gridCellSpan(node, axis)
+	if err != nil {
+		return emptySize, err
+	}
+
+	if axis == FlowHorizontal {
+		return math.Max(size-node.Margin.left-node.Margin.right, emptySize), nil
+	}
+	return math.Max(size-node.Margin.top-node.Margin.bottom, emptySize), nil
+}
+
+// gridOffsets calculates the offset of the bounding rect of every child in the
+// normal flow from the top left of the grid's draw rect.  Each child is
+// aligned within its area according to the grid's child alignment, and as in
+// CSS, `AlignSelf` overrides the vertical alignment.
+func gridOffsets(node *LayoutNode, children []*LayoutNode, widths []Size, heights []Size) ([]Size, []Size, error) {
+	xOffsets := make([]Size, len(children))
+	yOffsets := make([]Size, len(children))
+
+	for idx, child := range children {
+		offset, cell, err := node.gridCellRect(child)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		xOffsets[idx] = offset.x + crossAxisOffset(node.ChildAlignment.Horizontal, cell.width, widths[idx])
+		yOffsets[idx] = offset.y + crossAxisOffset(child.crossAlignment(node.ChildAlignment.Vertical), cell.height, heights[idx])
+	}
+
+	return xOffsets, yOffsets, nil
+}
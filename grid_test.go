@@ -0,0 +1,152 @@
+package docspec
+
+import "testing"
+
+// gridChildRects lays out a grid filling the width of the page, and returns
+// the render rects of its children
+func gridChildRects(t *testing.T, props LayoutNodeProps, tracks GridProps, cb func(*LayoutNode)) []testRect {
+	t.Helper()
+
+	props.Width = WidthFill()
+	props.Height = HeightAsChildren()
+	grid := Grid(nil, props, tracks, cb)
+	layoutNodes(t, grid)
+
+	rects := make([]testRect, len(grid.Children))
+	for idx, child := range grid.Children {
+		rects[idx] = rectOf(t, child)
+	}
+	return rects
+}
+
+// area creates a grid child that fills its area, with a static size along
+// the axis of the auto tracks
+func area(parent *LayoutNode, props LayoutNodeProps) *LayoutNode {
+	if props.Width.isUnitialized() {
+		props.Width = WidthFill()
+	}
+	if props.Height.isUnitialized() {
+		props.Height = StaticSize(10)
+	}
+	return Div(parent, props, NoChildren)
+}
+
+func TestGridTracks(t *testing.T) {
+	tests := []struct {
+		name     string
+		props    LayoutNodeProps
+		tracks   GridProps
+		children func(*LayoutNode)
+		expected []testRect
+	}{
+		{
+			name:   "static, percentage and fraction columns",
+			tracks: GridProps{Columns: []GridTrack{TrackStatic(50), TrackPercentage(25), TrackFraction(1)}},
+			children: func(grid *LayoutNode) {
+				area(grid, LayoutNodeProps{})
+				area(grid, LayoutNodeProps{})
+				area(grid, LayoutNodeProps{})
+			},
+			expected: []testRect{{10, 10, 50, 10}, {60, 10, 48.975, 10}, {108.975, 10, 96.925, 10}},
+		},
+		{
+			name:   "fractions share the space left after the gaps",
+			props:  LayoutNodeProps{ColumnGap: 10, RowGap: 5},
+			tracks: GridProps{Columns: []GridTrack{TrackFraction(1), TrackFraction(3)}},
+			children: func(grid *LayoutNode) {
+				area(grid, LayoutNodeProps{})
+				area(grid, LayoutNodeProps{})
+				area(grid, LayoutNodeProps{})
+			},
+			expected: []testRect{{10, 10, 46.475, 10}, {66.475, 10, 139.425, 10}, {10, 25, 46.475, 10}},
+		},
+		{
+			name:   "auto tracks fit the largest child",
+			tracks: GridProps{Columns: []GridTrack{TrackAuto(), TrackFraction(1)}, Rows: []GridTrack{TrackAuto(), TrackStatic(30)}},
+			children: func(grid *LayoutNode) {
+				area(grid, LayoutNodeProps{Width: StaticSize(40), Height: StaticSize(20)})
+				area(grid, LayoutNodeProps{})
+				area(grid, LayoutNodeProps{Width: StaticSize(60)})
+			},
+			expected: []testRect{{10, 10, 40, 20}, {70, 10, 135.9, 10}, {10, 30, 60, 10}},
+		},
+		{
+			name:   "children span several tracks",
+			props:  LayoutNodeProps{ColumnGap: 5},
+			tracks: GridProps{Columns: []GridTrack{TrackStatic(50), TrackStatic(50), TrackStatic(50)}},
+			children: func(grid *LayoutNode) {
+				area(grid, LayoutNodeProps{GridColumnSpan: 2})
+				area(grid, LayoutNodeProps{Height: HeightFill(), GridRowSpan: 2})
+				area(grid, LayoutNodeProps{})
+			},
+			expected: []testRect{{10, 10, 105, 10}, {120, 10, 50, 20}, {10, 20, 50, 10}},
+		},
+		{
+			name:   "children are placed explicitly and the rest flow around them",
+			tracks: GridProps{Columns: []GridTrack{TrackStatic(50), TrackStatic(50)}},
+			children: func(grid *LayoutNode) {
+				area(grid, LayoutNodeProps{GridColumn: 2, GridRow: 1})
+				area(grid, LayoutNodeProps{})
+				area(grid, LayoutNodeProps{})
+			},
+			expected: []testRect{{60, 10, 50, 10}, {10, 10, 50, 10}, {10, 20, 50, 10}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := gridChildRects(t, test.props, test.tracks, test.children)
+			if len(actual) != len(test.expected) {
+				t.Fatalf("expected %d children, got %d", len(test.expected), len(actual))
+			}
+			for idx, expected := range test.expected {
+				if !actual[idx].equals(expected) {
+					t.Errorf("child %d: expected %+v, got %+v", idx, expected, actual[idx])
+				}
+			}
+		})
+	}
+}
+
+func TestGridAutoTracksMeasureRelativeChildren(t *testing.T) {
+	renderer := newTestRenderer(t)
+	text := TextNode{Text: "Invoice number", FontSize: 10}
+	inherent := renderer.GetInherentTextRect(text)
+
+	actual := gridChildRects(t, LayoutNodeProps{}, GridProps{Columns: []GridTrack{TrackAuto(), TrackFraction(1)}}, func(grid *LayoutNode) {
+		Text(grid, LayoutNodeProps{Width: WidthFill(), Height: HeightFill()}, text)
+		area(grid, LayoutNodeProps{Height: HeightFill()})
+	})
+
+	expected := []testRect{
+		{10, 10, inherent.width, inherent.height},
+		{10 + inherent.width, 10, 195.9 - inherent.width, inherent.height},
+	}
+	for idx := range expected {
+		if !actual[idx].equals(expected[idx]) {
+			t.Errorf("child %d: expected %+v, got %+v", idx, expected[idx], actual[idx])
+		}
+	}
+}
+
+func TestGridAlignSelf(t *testing.T) {
+	rects := gridChildRects(t, LayoutNodeProps{}, GridProps{Columns: []GridTrack{TrackStatic(50), TrackStatic(50), TrackStatic(50)}}, func(grid *LayoutNode) {
+		area(grid, LayoutNodeProps{Height: StaticSize(30)})
+		area(grid, LayoutNodeProps{AlignSelf: AlignSelfEnd})
+		area(grid, LayoutNodeProps{AlignSelf: AlignSelfCenter})
+	})
+
+	assertRects(t, []testRect{{10, 10, 50, 30}, {60, 30, 50, 10}, {110, 20, 50, 10}}, rects)
+}
+
+func TestGridLayoutScaling(t *testing.T) {
+	// the rows are thin enough for the largest grid to fit on a page
+	assertLinearScaling(t, 150, func(size int) *LayoutNode {
+		tracks := GridProps{Columns: []GridTrack{TrackFraction(1), TrackFraction(1), TrackFraction(1)}}
+		return Grid(nil, LayoutNodeProps{Width: WidthFill(), Height: HeightAsChildren()}, tracks, func(grid *LayoutNode) {
+			for idx := 0; idx < size*3; idx++ {
+				area(grid, LayoutNodeProps{Height: StaticSize(0.1)})
+			}
+		})
+	})
+}
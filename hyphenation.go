@@ -0,0 +1,266 @@
+package docspec
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+)
+
+/*
+Words are hyphenated using Liang's algorithm, the same algorithm that TeX uses,
+with TeX style hyphenation patterns.  Each pattern is a fragment of a word with
+a digit between letters, e.g. "1ca" or ".ach4", where "." marks the start or
+end of a word.  Every pattern found in a word contributes its digits, the
+highest digit at each position wins, and the word may be hyphenated wherever
+the winning digit is odd.  Words that the patterns get wrong are listed as
+exceptions, already hyphenated.
+
+Hyphenation works by inserting soft hyphens (U+00AD) into the words of the
+text before it is wrapped, so automatic hyphenation and soft hyphens written
+into the text by hand behave the same way: a line may be broken after a soft
+hyphen, in which case it is drawn as a hyphen at the end of the line, and
+otherwise it is not drawn at all.
+*/
+
+// HyphenationEnglish hyphenates text with the patterns for American English
+const HyphenationEnglish = "en"
+
+// softHyphen marks a point in a word at which a line may be broken
+const softHyphen = '\u00AD'
+
+// hyphenationSource is the text of the patterns and exceptions of a language,
+// which are parsed the first time that they are used
+type hyphenationSource struct {
+	patterns   string
+	exceptions string
+	leftMin    int
+	rightMin   int
+}
+
+// hyphenationPatterns are the parsed patterns and exceptions of a language
+type hyphenationPatterns struct {
+	// the digits of each pattern, one before each letter and one after the
+	// last letter, by the letters of the pattern
+	patterns map[string][]int
+	// the number of letters in the longest pattern
+	longest int
+	// the positions in each exceptional word at which it may be hyphenated
+	exceptions map[string][]int
+	// the fewest letters that may be left before and after a hyphen
+	leftMin  int
+	rightMin int
+}
+
+var (
+	hyphenationMutex   sync.Mutex
+	hyphenationSources = map[string]hyphenationSource{
+		HyphenationEnglish: {englishHyphenationPatterns, englishHyphenationExceptions, 2, 3},
+	}
+	hyphenationLanguages = map[string]*hyphenationPatterns{}
+)
+
+// RegisterHyphenationPatterns makes a language available for hyphenation,
+// given TeX style patterns and exceptions separated by whitespace, e.g.
+// ".ach4 1ca" and "ta-ble".  leftMin and rightMin are the fewest letters that
+// may be left before and after a hyphen.  Languages are looked up by their
+// lowercase tag, falling back to the language without its region, so the
+// patterns of "de" are also used for "de-AT".
+func RegisterHyphenationPatterns(language string, patterns string, exceptions string, leftMin int, rightMin int) {
+	hyphenationMutex.Lock()
+	defer hyphenationMutex.Unlock()
+
+	language = strings.ToLower(language)
+	hyphenationSources[language] = hyphenationSource{patterns, exceptions, leftMin, rightMin}
+	delete(hyphenationLanguages, language)
+}
+
+// hyphenationFor returns the patterns of a language, or nil if there are no
+// patterns for the language
+func hyphenationFor(language string) *hyphenationPatterns {
+	hyphenationMutex.Lock()
+	defer hyphenationMutex.Unlock()
+
+	language = strings.ToLower(language)
+	if _, ok := hyphenationSources[language]; !ok {
+		language = strings.SplitN(language, "-", 2)[0]
+	}
+
+	if patterns, ok := hyphenationLanguages[language]; ok {
+		return patterns
+	}
+
+	source, ok := hyphenationSources[language]
+	if !ok {
+		return nil
+	}
+
+	patterns := parseHyphenationPatterns(source)
+	hyphenationLanguages[language] = patterns
+	return patterns
+}
+
+func parseHyphenationPatterns(source hyphenationSource) *hyphenationPatterns {
+	result := &hyphenationPatterns{
+		patterns:   make(map[string][]int),
+		exceptions: make(map[string][]int),
+		leftMin:    source.leftMin,
+		rightMin:   source.rightMin,
+	}
+
+	for _, pattern := range strings.Fields(source.patterns) {
+		letters := make([]rune, 0, len(pattern))
+		digits := []int{0}
+		for _, char := range pattern {
+			if char >= '0' && char <= '9' {
+				digits[len(digits)-1] = int(char - '0')
+				continue
+			}
+			letters = append(letters, unicode.ToLower(char))
+			digits = append(digits, 0)
+		}
+
+		result.patterns[string(letters)] = digits
+		if len(letters) > result.longest {
+			result.longest = len(letters)
+		}
+	}
+
+	for _, exception := range strings.Fields(source.exceptions) {
+		letters := make([]rune, 0, len(exception))
+		points := make([]int, 0)
+		for _, char := range exception {
+			if char == '-' {
+				points = append(points, len(letters))
+				continue
+			}
+			letters = append(letters, unicode.ToLower(char))
+		}
+		result.exceptions[string(letters)] = points
+	}
+
+	return result
+}
+
+// hyphenationPoints returns the indexes of the letters of a word before which
+// the word may be hyphenated
+func (p *hyphenationPatterns) hyphenationPoints(word []rune) []int {
+	lower := make([]rune, len(word))
+	for idx, char := range word {
+		lower[idx] = unicode.ToLower(char)
+	}
+
+	allowed := func(point int) bool {
+		return point >= p.leftMin && point <= len(word)-p.rightMin
+	}
+
+	points := make([]int, 0)
+	if exception, ok := p.exceptions[string(lower)]; ok {
+		for _, point := range exception {
+			if allowed(point) {
+				points = append(points, point)
+			}
+		}
+		return points
+	}
+
+	// digits[i] is the digit before the letter at index i of the word padded
+	// with a "." on either side
+	padded := append(append([]rune{'.'}, lower...), '.')
+	digits := make([]int, len(padded)+1)
+	for start := range padded {
+		for end := start + 1; end <= len(padded) && end-start <= p.longest; end++ {
+			pattern, ok := p.patterns[string(padded[start:end])]
+			if !ok {
+				continue
+			}
+			for idx, digit := range pattern {
+				if digit > digits[start+idx] {
+					digits[start+idx] = digit
+				}
+			}
+		}
+	}
+
+	for point := range word {
+		if allowed(point) && digits[point+1]%2 == 1 {
+			points = append(points, point)
+		}
+	}
+
+	return points
+}
+
+// hyphenate inserts a soft hyphen at every point at which the words of the
+// text may be hyphenated in the given language.  Words that already contain
+// soft hyphens are left as they are, so that hyphenation by hand takes
+// precedence.  Text in a language without patterns is not hyphenated.
+func hyphenate(text string, language string) string {
+	if language == "" {
+		return text
+	}
+
+	patterns := hyphenationFor(language)
+	if patterns == nil {
+		return text
+	}
+
+	var result strings.Builder
+	chars := []rune(text)
+	for start := 0; start < len(chars); {
+		if !unicode.IsLetter(chars[start]) {
+			result.WriteRune(chars[start])
+			start++
+			continue
+		}
+
+		end := start
+		for end < len(chars) && (unicode.IsLetter(chars[end]) || chars[end] == softHyphen) {
+			end++
+		}
+		word := chars[start:end]
+
+		points := make([]int, 0)
+		if !strings.ContainsRune(string(word), softHyphen) {
+			points = patterns.hyphenationPoints(word)
+		}
+
+		for idx, char := range word {
+			if len(points) > 0 && points[0] == idx {
+				result.WriteRune(softHyphen)
+				points = points[1:]
+			}
+			result.WriteRune(char)
+		}
+
+		start = end
+	}
+
+	return result.String()
+}
+
+// visibleText returns the visible part of a line as it is drawn: soft hyphens
+// are removed, except for one at the very end of the line, where the line was
+// broken at it, which is drawn as a hyphen
+func visibleText(line string) string {
+	hyphenated := strings.HasSuffix(line, string(softHyphen))
+	line = strings.ReplaceAll(line, string(softHyphen), "")
+	if hyphenated {
+		line += "-"
+	}
+	return line
+}
+
+// visibleSpans returns the visible part of a line of rich text as it is
+// drawn, in the same way as visibleText
+func visibleSpans(line []TextSpan) []TextSpan {
+	result := make([]TextSpan, len(line))
+	for idx, span := range line {
+		if idx == len(line)-1 {
+			span.Text = visibleText(span.Text)
+		} else {
+			span.Text = strings.ReplaceAll(span.Text, string(softHyphen), "")
+		}
+		result[idx] = span
+	}
+	return result
+}
@@ -0,0 +1,116 @@
+package docspec
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// showHyphens replaces soft hyphens with "-" so that they can be seen
+func showHyphens(text string) string {
+	return strings.ReplaceAll(text, string(softHyphen), "-")
+}
+
+func TestHyphenate(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		language string
+		expected string
+	}{
+		{"words are hyphenated with the patterns", "hyphenation computer table", HyphenationEnglish, "hy-phen-a-tion com-puter ta-ble"},
+		{"exceptions take precedence over the patterns", "academies associate", HyphenationEnglish, "acad-e-mies as-so-ciate"},
+		{"capitalized words", "Hyphenation", HyphenationEnglish, "Hy-phen-a-tion"},
+		{"short words are left whole", "the cat sat", HyphenationEnglish, "the cat sat"},
+		{"words hyphenated by hand are left as they are", "extra\u00adordinary", HyphenationEnglish, "extra-ordinary"},
+		{"punctuation is kept", "well-known, table.", HyphenationEnglish, "well-known, ta-ble."},
+		{"region falls back to the language", "hyphenation", "en-US", "hy-phen-a-tion"},
+		{"no language", "hyphenation", "", "hyphenation"},
+		{"language without patterns", "hyphenation", "xx", "hyphenation"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if hyphenated := showHyphens(hyphenate(test.text, test.language)); hyphenated != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, hyphenated)
+			}
+		})
+	}
+}
+
+func TestRegisterHyphenationPatterns(t *testing.T) {
+	RegisterHyphenationPatterns("x-test", "1b", "ab-ba", 1, 1)
+
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"abab", "a-ba-b"},
+		{"ABBA", "AB-BA"},
+		{"b", "b"},
+	}
+
+	for _, test := range tests {
+		if hyphenated := showHyphens(hyphenate(test.text, "X-Test")); hyphenated != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.text, test.expected, hyphenated)
+		}
+	}
+}
+
+func TestVisibleText(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{"hy\u00adphen\u00ada\u00ad", "hyphena-"},
+		{"hy\u00adphen\u00adation", "hyphenation"},
+		{"well-known", "well-known"},
+	}
+
+	for _, test := range tests {
+		if visible := visibleText(test.line); visible != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.line, test.expected, visible)
+		}
+	}
+}
+
+func TestSplitHyphenatedText(t *testing.T) {
+	renderer := newTestRenderer(t)
+	text := "The hyphenation of extraordinary words"
+
+	tests := []struct {
+		name        string
+		hyphenation string
+		text        string
+		expected    []string
+	}{
+		{
+			name:        "words are broken at their hyphenation points",
+			hyphenation: HyphenationEnglish,
+			text:        text,
+			expected:    []string{"The hyphena-", "tion of extraor-", "dinary words"},
+		},
+		{
+			name:     "words aren't hyphenated without a language",
+			text:     text,
+			expected: []string{"The ", "hyphenation of ", "extraordinary ", "words"},
+		},
+		{
+			name:     "soft hyphens are honored without a language",
+			text:     "The extra\u00adordinary",
+			expected: []string{"The extra-", "ordinary"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines := renderer.SplitText(Rect{30, 100}, TextNode{Text: test.text, FontFamily: "Inter", FontSize: 10, Hyphenation: test.hyphenation})
+			for idx, line := range lines {
+				lines[idx] = visibleText(line)
+			}
+			if !reflect.DeepEqual(lines, test.expected) {
+				t.Errorf("expected %q, got %q", test.expected, lines)
+			}
+		})
+	}
+}
@@ -8,14 +8,13 @@ import "fmt"
 // content into the rect defined by the LayoutNode.
 //
 // Splitting over pages is determined by testing if the node's height would
-// take it over the draw rect of the current page.  If it would, then the tree
-// is traversed backwards until the parent node that is a direct child of the
-// Page is found, and the origin of that node is placed at the origin of the
-// page, and x,y coordination calculation continues down the page as before.
-// If that parent node's height is greater than the height of the page (i.e.
-// the node cannot fit on a single page), then an error is raised.  An error is
-// also raised is a node's measured height is greater than the height of any page,
-// meaning that the above test would result in infinite recursion.
+// take it over the draw rect of the current page.  If it would, then the node
+// is split into two fragments: one that fills the rest of the current page,
+// and one that continues at the top of the next page.  Children that don't fit
+// are moved into the second fragment, the child straddling the page boundary
+// is itself split the same way, and text is split between its wrapped lines.
+// An error is only raised if some part of the tree can never fit on a page,
+// such as an image that is taller than the draw rect of an empty page.
 //
 // Layout calculation takes place in two phases: first the widths and heights
 // of all the nodes are calculated, and then the x,y coordinates of each rect
@@ -31,6 +30,10 @@ type LayoutNode struct {
 	Y                  Size
 	Width              Future
 	Height             Future
+	MinWidth           Size
+	MaxWidth           Size
+	MinHeight          Size
+	MaxHeight          Size
 	Border             BooleanQuad
 	BorderColor        Color
 	ShowFill           bool
@@ -39,6 +42,35 @@ type LayoutNode struct {
 	Margin             SizesQuad
 	ChildAlignment     LayoutChildAlignment
 	ChildFlowDirection childFlowDirection
+	AlignSelf          selfAlignment
+	ChildWrap          bool
+	RowGap             Size
+	ColumnGap          Size
+	Position           positionMode
+	OffsetX            Size
+	OffsetY            Size
+	ZIndex             int
+	PageBreakBefore    bool
+	PageBreakAfter     bool
+	KeepTogether       bool
+	KeepWithNext       bool
+	FlexGrow           Size
+	FlexShrink         Size
+	FlexBasis          Future
+	GridColumn         int
+	GridRow            int
+	GridColumnSpan     int
+	GridRowSpan        int
+	// grid is set on nodes created by the Grid constructor, and holds the
+	// grid's track definitions.
+	grid *GridProps
+	// gridLayout caches the placement and track sizes of a grid's children
+	// for the duration of a layout pass, and is thrown away along with the
+	// cached futures.
+	gridLayout *gridLayout
+	// section is set on nodes created by the Section constructor, and holds
+	// the page geometry for the section's children.
+	section *SectionProps
 	// renderContext is set by the DocumentBuilder on each node when it starts
 	// rendering, so that the node can use the renderer to calculate inherent
 	// sizes.
@@ -51,8 +83,11 @@ func (n *LayoutNode) Clone() *LayoutNode {
 	root := *n
 	root.Children = make([]*LayoutNode, 0)
 
+	root.bindFutures()
+	root.invalidateSizes()
+
 	for _, child := range n.Children {
-		root.addChild(child.Clone())
+		root.adoptChild(child.Clone())
 	}
 
 	return &root
@@ -62,17 +97,88 @@ func (n *LayoutNode) addChild(node *LayoutNode) {
 	n.Children = append(n.Children, node)
 }
 
+// adoptChild adds the node as a child, and points the node's parent at the
+// new parent.  Used when moving nodes between copies of a tree.
+func (n *LayoutNode) adoptChild(node *LayoutNode) {
+	node.Parent = n
+	n.addChild(node)
+}
+
+// bindFutures points every future in the node back at the node, which is
+// required whenever a node or its futures are copied.
+func (n *LayoutNode) bindFutures() {
+	n.Width.bind(n, "Width")
+	n.Height.bind(n, "Height")
+	n.FlexBasis.bind(n, "FlexBasis")
+}
+
+// getWidth resolves the width of the node's render rect, within the node's
+// min and max width
+func (n *LayoutNode) getWidth() (Size, error) {
+	width, err := n.Width.await()
+	if err != nil {
+		return emptySize, err
+	}
+
+	return n.clampSize(FlowHorizontal, width), nil
+}
+
+// getHeight resolves the height of the node's render rect, within the node's
+// min and max height
+func (n *LayoutNode) getHeight() (Size, error) {
+	height, err := n.Height.await()
+	if err != nil {
+		return emptySize, err
+	}
+
+	return n.clampSize(FlowVertical, height), nil
+}
+
+// clampSize limits a size along the given axis to the node's min and max
+// size along that axis.  As in CSS, the min size wins if the two conflict.
+func (n *LayoutNode) clampSize(axis childFlowDirection, size Size) Size {
+	min, max := n.MinHeight, n.MaxHeight
+	if axis == FlowHorizontal {
+		min, max = n.MinWidth, n.MaxWidth
+	}
+
+	if max > 0 && size > max {
+		size = max
+	}
+
+	if size < min {
+		size = min
+	}
+
+	return size
+}
+
+// invalidateSizes throws away the cached sizes of every node in the tree below
+// (and including) the node.  Must be called whenever the node is moved to a
+// different context after its sizes may have been resolved, since its sizes
+// may depend on that context.
+func (n *LayoutNode) invalidateSizes() {
+	n.Width.invalidate()
+	n.Height.invalidate()
+	n.FlexBasis.invalidate()
+	n.gridLayout = nil
+
+	for _, child := range n.Children {
+		child.invalidateSizes()
+	}
+}
+
 // returns the bounding rect of the node, i.e. the rectangle inside of which
 // nothing but the node can render (defined as the node's rect itself + the
 // node's margins)
-func (n LayoutNode) getBoundingRect() (Rect, error) {
-	width, err := n.Width.await()
+func (n *LayoutNode) getBoundingRect() (Rect, error) {
+	width, err := n.getWidth()
 
 	if err != nil {
 		return Rect{}, err
 	}
 
-	height, err := n.Height.await()
+	height, err := n.getHeight()
 
 	if err != nil {
 		return Rect{}, err
@@ -84,8 +190,8 @@ func (n LayoutNode) getBoundingRect() (Rect, error) {
 	return Rect{width, height}, nil
 }
 
-func (n LayoutNode) getBoundingHeight() (Size, error) {
-	height, err := n.Height.await()
+func (n *LayoutNode) getBoundingHeight() (Size, error) {
+	height, err := n.getHeight()
 
 	if err != nil {
 		return emptySize, err
@@ -95,8 +201,8 @@ func (n LayoutNode) getBoundingHeight() (Size, error) {
 	return height, nil
 }
 
-func (n LayoutNode) getBoundingWidth() (Size, error) {
-	width, err := n.Width.await()
+func (n *LayoutNode) getBoundingWidth() (Size, error) {
+	width, err := n.getWidth()
 
 	if err != nil {
 		return emptySize, err
@@ -109,13 +215,13 @@ func (n LayoutNode) getBoundingWidth() (Size, error) {
 // getRenderRect gets the rect into which the node renders.  In other words,
 // the rectangle that lies outside the draw rect of the node (because of
 // padding) but inside the bounding rect (because of margin).
-func (n LayoutNode) getRenderRect() (Rect, error) {
-	width, err := n.Width.await()
+func (n *LayoutNode) getRenderRect() (Rect, error) {
+	width, err := n.getWidth()
 	if err != nil {
 		return Rect{}, err
 	}
 
-	height, err := n.Height.await()
+	height, err := n.getHeight()
 	if err != nil {
 		return Rect{}, err
 	}
@@ -125,43 +231,121 @@ func (n LayoutNode) getRenderRect() (Rect, error) {
 
 // getDrawRect gets the rect into which children of the node must render,
 // defined as the render rect minus the inner padding of the node.
-func (n LayoutNode) getDrawRect() (Rect, error) {
+func (n *LayoutNode) getDrawRect() (Rect, error) {
 	width, err := n.getDrawWidth()
 	if err != nil {
-		return Rect{}, nil
+		return Rect{}, err
 	}
 
 	height, err := n.getDrawHeight()
 	if err != nil {
-		return Rect{}, nil
+		return Rect{}, err
 	}
 
 	return Rect{width, height}, nil
 }
 
-func (n LayoutNode) getDrawWidth() (Size, error) {
-	width, err := n.Width.await()
+func (n *LayoutNode) getDrawWidth() (Size, error) {
+	width, err := n.getWidth()
 	if err != nil {
-		return 0.0, nil
+		return 0.0, err
 	}
 
 	width -= n.Padding.left + n.Padding.right
 	return width, nil
 }
 
-func (n LayoutNode) getDrawHeight() (Size, error) {
-	height, err := n.Height.await()
+func (n *LayoutNode) getDrawHeight() (Size, error) {
+	height, err := n.getHeight()
 	if err != nil {
-		return 0.0, nil
+		return 0.0, err
 	}
 
 	height -= n.Padding.top + n.Padding.bottom
 	return height, nil
 }
 
-func (n LayoutNode) log() {
-	width, _ := n.Width.await()
-	height, _ := n.Height.await()
+// wrapLines breaks the children of a node with `ChildWrap` into the lines
+// that they are laid out in, leaving out any children that are not in the
+// normal flow.  A child starts a new line if it would overflow
+// the draw rect of the node, unless it's the first child on the line.  Lines
+// are decided before any free space is shared out between fills, so fills
+// take up only their basis here.
+func (n *LayoutNode) wrapLines() ([][]*LayoutNode, error) {
+	available, err := n.getDrawWidth()
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([][]*LayoutNode, 0)
+	line := make([]*LayoutNode, 0)
+	used := emptySize
+
+	for _, child := range n.flowChildren() {
+		width, err := child.hypotheticalWidth()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(line) > 0 && used+n.ColumnGap+width > available+layoutEpsilon {
+			lines = append(lines, line)
+			line = make([]*LayoutNode, 0)
+			used = emptySize
+		}
+
+		if len(line) > 0 {
+			used += n.ColumnGap
+		}
+		line = append(line, child)
+		used += width
+	}
+
+	if len(line) > 0 {
+		lines = append(lines, line)
+	}
+
+	return lines, nil
+}
+
+// gapAlong returns the gap between the node's children along the given axis
+func (n *LayoutNode) gapAlong(axis childFlowDirection) Size {
+	if axis == FlowHorizontal {
+		return n.ColumnGap
+	}
+	return n.RowGap
+}
+
+// totalGap returns the space taken up by the gaps between count items
+func totalGap(gap Size, count int) Size {
+	if count < 2 {
+		return emptySize
+	}
+	return gap * float64(count-1)
+}
+
+// hypotheticalWidth is the width of the node's bounding rect before the free
+// space in its parent is shared out, i.e. the basis of a fill.
+func (n *LayoutNode) hypotheticalWidth() (Size, error) {
+	if !n.Width.fill {
+		return n.getBoundingWidth()
+	}
+
+	width := emptySize
+	_, _, basis := n.flexFactors()
+	if basis != nil {
+		b, err := basis.await()
+		if err != nil {
+			return emptySize, err
+		}
+		width = b
+	}
+
+	return n.clampSize(FlowHorizontal, width) + n.Margin.left + n.Margin.right, nil
+}
+
+func (n *LayoutNode) log() {
+	width, _ := n.getWidth()
+	height, _ := n.getHeight()
 
 	fmt.Printf("layout node; x: %f, y: %f, width: %f, height: %f\n", n.X, n.Y, width, height)
 }
@@ -172,6 +356,10 @@ type childAlignment int
 
 type childFlowDirection int
 
+type selfAlignment int
+
+type positionMode int
+
 const (
 	// FlowVertical represents a list of children that should flow from top to
 	// bottom within the parent.
@@ -181,10 +369,6 @@ const (
 	FlowHorizontal
 )
 
-// Note that we intentially leave out "justify-between" as this entire
-// layout engine is for statically known layouts, so setting width
-// percentages manually is better.
-
 const (
 	// Start is equal to justify-content: start in CSS
 	Start childAlignment = iota
@@ -192,8 +376,80 @@ const (
 	End
 	// Center is equal to justify-content: center in CSS
 	Center
+	// SpaceBetween is equal to justify-content: space-between in CSS.  Like
+	// the other distribution modes, it only applies along the direction in
+	// which the children flow, and behaves like Start along the other axis.
+	SpaceBetween
+	// SpaceAround is equal to justify-content: space-around in CSS
+	SpaceAround
+	// SpaceEvenly is equal to justify-content: space-evenly in CSS
+	SpaceEvenly
 )
 
+const (
+	// AlignSelfAuto aligns the node according to its parent's ChildAlignment
+	AlignSelfAuto selfAlignment = iota
+	// AlignSelfStart is equal to align-self: start in CSS
+	AlignSelfStart
+	// AlignSelfEnd is equal to align-self: end in CSS
+	AlignSelfEnd
+	// AlignSelfCenter is equal to align-self: center in CSS
+	AlignSelfCenter
+)
+
+// crossAlignment returns the alignment of the node along its parent's cross
+// axis, given the parent's alignment along that axis.
+func (n *LayoutNode) crossAlignment(parentAlignment childAlignment) childAlignment {
+	switch n.AlignSelf {
+	case AlignSelfStart:
+		return Start
+	case AlignSelfEnd:
+		return End
+	case AlignSelfCenter:
+		return Center
+	default:
+		return parentAlignment
+	}
+}
+
+const (
+	// PositionStatic places the node in the normal flow of its siblings
+	PositionStatic positionMode = iota
+	// PositionRelative places the node in the normal flow of its siblings,
+	// and then moves it by its offsets without affecting the siblings
+	PositionRelative
+	// PositionAbsolute takes the node out of the normal flow, and places it
+	// at its offsets from the top left corner of the parent's render rect
+	// (or of the page's draw rect, for top level nodes)
+	PositionAbsolute
+	// PositionPage takes the node out of the normal flow, and places it at
+	// its offsets from the top left corner of the page it ends up on
+	PositionPage
+)
+
+// isOutOfFlow returns whether the node has been taken out of the normal flow
+// of its siblings, in which case it neither takes up space among them nor is
+// sized in terms of them.
+func (n *LayoutNode) isOutOfFlow() bool {
+	return n.Position == PositionAbsolute || n.Position == PositionPage
+}
+
+// flowChildren returns the node's children that are in the normal flow
+func (n *LayoutNode) flowChildren() []*LayoutNode {
+	return inFlow(n.Children)
+}
+
+// inFlow filters a list of nodes down to the ones that are in the normal flow
+func inFlow(nodes []*LayoutNode) []*LayoutNode {
+	result := make([]*LayoutNode, 0, len(nodes))
+	for _, node := range nodes {
+		if !node.isOutOfFlow() {
+			result = append(result, node)
+		}
+	}
+	return result
+}
+
 // LayoutChildAlignment configures where on the x and y axis inside a given
 // node to position that node's children
 type LayoutChildAlignment struct {
@@ -292,17 +548,81 @@ func CreateNodeList(nodes ...*LayoutNode) []*LayoutNode {
 // LayoutNodeProps is the subset of the properties of the LayoutNode struct
 // which can be passed into node constructors.
 type LayoutNodeProps struct {
-	ID                 string
-	Border             BooleanQuad
-	BorderColor        Color
-	ShowFill           bool
-	FillColor          Color
-	Padding            SizesQuad
-	Margin             SizesQuad
-	Width              Future
-	Height             Future
+	ID          string
+	Border      BooleanQuad
+	BorderColor Color
+	ShowFill    bool
+	FillColor   Color
+	Padding     SizesQuad
+	Margin      SizesQuad
+	Width       Future
+	Height      Future
+	// MinWidth, MaxWidth, MinHeight and MaxHeight clamp the resolved Width
+	// and Height of the node.  A max of 0 means that there is no max.
+	MinWidth           Size
+	MaxWidth           Size
+	MinHeight          Size
+	MaxHeight          Size
 	ChildAlignment     LayoutChildAlignment
 	ChildFlowDirection childFlowDirection
+	// AlignSelf overrides the parent's ChildAlignment for this node along the
+	// axis perpendicular to the one in which the parent's children flow (or
+	// vertically, within a grid).
+	AlignSelf selfAlignment
+	// ChildWrap moves children onto a new line when they would overflow the
+	// width of the node.  Only applies to `FlowHorizontal`.
+	ChildWrap bool
+	// RowGap and ColumnGap add space between the children of the node, but
+	// not between the children and the edges of the node.  RowGap separates
+	// children stacked from top to bottom (including the lines of a wrapping
+	// node and the rows of a grid), and ColumnGap separates children placed
+	// from left to right.
+	RowGap    Size
+	ColumnGap Size
+	// Position controls how the node is placed, see `PositionStatic` and
+	// the other positioning modes.  OffsetX and OffsetY move the node from
+	// the position given by its positioning mode.
+	Position positionMode
+	OffsetX  Size
+	OffsetY  Size
+	// ZIndex paints the node and its children above (if positive) or below
+	// (if negative) its siblings and their children, regardless of the order
+	// of the nodes in the tree.
+	ZIndex int
+	// PageBreakBefore and PageBreakAfter force the node to start on a new
+	// page, or force whatever follows the node to start on a new page.  They
+	// apply between the children of a column and between the rows of a grid,
+	// at any depth, but are ignored inside of rows (wrapping or not) and in
+	// the middle of the children of a grid, since grid rows are never split.
+	PageBreakBefore bool
+	PageBreakAfter  bool
+	// KeepTogether prevents the node from being split over two pages, unless
+	// it is too tall to fit on any page.
+	KeepTogether bool
+	// KeepWithNext prevents a page break between the node and its next
+	// sibling, e.g. to avoid a heading being left at the bottom of a page.
+	KeepWithNext bool
+	// FlexGrow, FlexShrink and FlexBasis behave like their CSS counterparts
+	// along the direction in which the parent's children flow.  Setting any
+	// of them makes the node's size along that axis flexible: it starts at
+	// FlexBasis (or the node's Width/Height if FlexBasis is not set), grows by
+	// its share of the space left over in the parent in proportion to
+	// FlexGrow, and shrinks in proportion to FlexShrink (weighted by the
+	// basis) if its siblings overflow the parent.  A top level node has no
+	// flexible siblings, since the nodes after it move on to the next page if
+	// they don't fit: it flexes into whatever is left of the page below the
+	// nodes before it, or into the whole of the next page if nothing is left.
+	FlexGrow   Size
+	FlexShrink Size
+	FlexBasis  Future
+	// GridColumn and GridRow place the node in a specific cell of its parent
+	// grid, counting from 1.  Leaving either as 0 places the node in the next
+	// free cell along the other.  GridColumnSpan and GridRowSpan make the
+	// node take up that many cells, and default to 1.
+	GridColumn     int
+	GridRow        int
+	GridColumnSpan int
+	GridRowSpan    int
 }
 
 // mergeProps merges LayoutNodeProps (which is a subset of LayoutNode) into the
@@ -321,8 +641,68 @@ func (n *LayoutNode) mergeProps(props LayoutNodeProps) {
 	n.Margin = props.Margin
 	n.ChildAlignment = props.ChildAlignment
 	n.ChildFlowDirection = props.ChildFlowDirection
+	n.AlignSelf = props.AlignSelf
+	n.ChildWrap = props.ChildWrap
+	n.RowGap = props.RowGap
+	n.ColumnGap = props.ColumnGap
+	n.Position = props.Position
+	n.OffsetX = props.OffsetX
+	n.OffsetY = props.OffsetY
+	n.ZIndex = props.ZIndex
 	n.Width = props.Width
 	n.Height = props.Height
+	n.MinWidth = props.MinWidth
+	n.MaxWidth = props.MaxWidth
+	n.MinHeight = props.MinHeight
+	n.MaxHeight = props.MaxHeight
+	n.PageBreakBefore = props.PageBreakBefore
+	n.PageBreakAfter = props.PageBreakAfter
+	n.KeepTogether = props.KeepTogether
+	n.KeepWithNext = props.KeepWithNext
+	n.FlexGrow = props.FlexGrow
+	n.FlexShrink = props.FlexShrink
+	n.FlexBasis = props.FlexBasis
+	n.GridColumn = props.GridColumn
+	n.GridRow = props.GridRow
+	n.GridColumnSpan = props.GridColumnSpan
+	n.GridRowSpan = props.GridRowSpan
+
+	if n.hasFlexProps() {
+		// the flex properties replace the size along the main axis of the
+		// parent, which becomes the basis unless one was given explicitly
+		if n.Parent != nil && n.Parent.ChildFlowDirection == FlowHorizontal {
+			if n.FlexBasis.isUnitialized() && !n.Width.fill {
+				n.FlexBasis = n.Width
+			}
+			n.Width = WidthFill()
+		} else {
+			if n.FlexBasis.isUnitialized() && !n.Height.fill {
+				n.FlexBasis = n.Height
+			}
+			n.Height = HeightFill()
+		}
+	}
+}
+
+// hasFlexProps returns whether any of the flex properties were set on the
+// node
+func (n *LayoutNode) hasFlexProps() bool {
+	return n.FlexGrow != 0 || n.FlexShrink != 0 || !n.FlexBasis.isUnitialized()
+}
+
+// flexFactors returns the grow factor, shrink factor and basis of a node whose
+// size along the main axis of its parent is a fill.  A fill without any flex
+// properties grows to take up an equal share of the free space with any other
+// fills.  The basis is nil if the node doesn't have one.
+func (n *LayoutNode) flexFactors() (Size, Size, *Future) {
+	if n.hasFlexProps() {
+		if n.FlexBasis.isUnitialized() {
+			return n.FlexGrow, n.FlexShrink, nil
+		}
+		return n.FlexGrow, n.FlexShrink, &n.FlexBasis
+	}
+
+	return 1.0, 0.0, nil
 }
 
 // Div inserts a plain layout node into the document tree
@@ -335,8 +715,7 @@ func Div(parent *LayoutNode, options LayoutNodeProps, cb func(*LayoutNode)) *Lay
 	}
 	newNode.mergeProps(options)
 
-	newNode.Width.node = newNode
-	newNode.Height.node = newNode
+	newNode.bindFutures()
 
 	cb(newNode)
 
@@ -347,6 +726,41 @@ func Div(parent *LayoutNode, options LayoutNodeProps, cb func(*LayoutNode)) *Lay
 	return newNode
 }
 
+// SectionProps configures the pages of a section of the document.
+type SectionProps struct {
+	// Size of the section's pages, including their orientation.  If nil, the
+	// size of the previous page is used.
+	Size *documentSize
+	// Margin of the section's pages.  If nil, the margin of the previous page
+	// is used, so a section without margins needs `Margin: &SizesQuad{}`.
+	Margin *SizesQuad
+}
+
+// Section creates a section of the document, which may only be used in the
+// node list passed to `CreateDocumentTree`.  The top level nodes created in
+// the callback start on a new page, and are laid out onto pages with the
+// section's size and margin.  The section ends with its last node: any nodes
+// that follow it in the node list start on a new page with the size and
+// margin given to the document builder.  A section cannot be nested inside of
+// another node.
+func Section(props SectionProps, cb func(*LayoutNode)) *LayoutNode {
+	sectionProps := props
+	section := &LayoutNode{
+		Children: make([]*LayoutNode, 0),
+		section:  &sectionProps,
+	}
+
+	cb(section)
+
+	// the children are top level nodes on the section's pages, rather than
+	// children of the section itself
+	for _, child := range section.Children {
+		child.Parent = nil
+	}
+
+	return section
+}
+
 // Text inserts a text component in the document tree
 func Text(parent *LayoutNode, options LayoutNodeProps, textProps TextNode) *LayoutNode {
 	// a "text node" is really three nodes -- a layout node for layout, a
@@ -357,12 +771,42 @@ func Text(parent *LayoutNode, options LayoutNodeProps, textProps TextNode) *Layo
 		Parent:     nil,
 		Page:       nil,
 		VisualNode: textProps,
-		Width:      newIncompleteFuture(widthFill, nil),
-		Height:     newIncompleteFuture(heightFill, nil),
+		Width:      WidthFill(),
+		Height:     HeightFill(),
+	}
+
+	wrapperNode.bindFutures()
+
+	layoutNode := &LayoutNode{
+		Parent:   parent,
+		Page:     nil,
+		Children: []*LayoutNode{wrapperNode},
+	}
+	wrapperNode.Parent = layoutNode
+
+	layoutNode.mergeProps(options)
+
+	layoutNode.bindFutures()
+
+	if parent != nil {
+		parent.Children = append(parent.Children, layoutNode)
+	}
+
+	return layoutNode
+}
+
+// RichText inserts a paragraph of text made of differently styled spans into
+// the document tree.  It is made up of nodes in the same way as `Text`.
+func RichText(parent *LayoutNode, options LayoutNodeProps, richTextProps RichTextNode) *LayoutNode {
+	wrapperNode := &LayoutNode{
+		Parent:     nil,
+		Page:       nil,
+		VisualNode: richTextProps,
+		Width:      WidthFill(),
+		Height:     HeightFill(),
 	}
 
-	wrapperNode.Width.node = wrapperNode
-	wrapperNode.Height.node = wrapperNode
+	wrapperNode.bindFutures()
 
 	layoutNode := &LayoutNode{
 		Parent:   parent,
@@ -373,8 +817,7 @@ func Text(parent *LayoutNode, options LayoutNodeProps, textProps TextNode) *Layo
 
 	layoutNode.mergeProps(options)
 
-	layoutNode.Width.node = layoutNode
-	layoutNode.Height.node = layoutNode
+	layoutNode.bindFutures()
 
 	if parent != nil {
 		parent.Children = append(parent.Children, layoutNode)
@@ -392,12 +835,11 @@ func Image(parent *LayoutNode, options LayoutNodeProps, imageProps ImageNode) *L
 		Parent:     nil,
 		Page:       nil,
 		VisualNode: imageProps,
-		Width:      newIncompleteFuture(widthFill, nil),
-		Height:     newIncompleteFuture(heightFill, nil),
+		Width:      WidthFill(),
+		Height:     HeightFill(),
 	}
 
-	wrapperNode.Width.node = wrapperNode
-	wrapperNode.Height.node = wrapperNode
+	wrapperNode.bindFutures()
 
 	layoutNode := &LayoutNode{
 		Parent:   parent,
@@ -408,8 +850,7 @@ func Image(parent *LayoutNode, options LayoutNodeProps, imageProps ImageNode) *L
 	wrapperNode.Parent = layoutNode
 	layoutNode.mergeProps(options)
 
-	layoutNode.Width.node = layoutNode
-	layoutNode.Height.node = layoutNode
+	layoutNode.bindFutures()
 
 	if parent != nil {
 		parent.Children = append(parent.Children, layoutNode)
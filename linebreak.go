@@ -0,0 +1,483 @@
+package docspec
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+Text is wrapped at the line break opportunities defined by the Unicode line
+breaking algorithm (UAX #14, https://www.unicode.org/reports/tr14/).  Every
+character is given a line breaking class, and the rules of the algorithm decide
+for each pair of characters whether a line may (or must) be broken between
+them.
+
+The implementation follows the rules of the algorithm in order, but simplifies
+the character classes that only matter for particular scripts: complex context
+scripts such as Thai (which need a dictionary to find word boundaries) are
+treated as alphabetic, Hebrew letters are treated as alphabetic, Korean jamo and
+syllables are treated as ideographs, and emoji modifiers are treated as
+combining marks.
+
+On top of the break opportunities, lines that contain a single word that is too
+long to fit are broken between any two characters.
+*/
+
+type breakClass int
+
+const (
+	// mandatory breaks
+	breakBK breakClass = iota
+	breakCR
+	breakLF
+	breakNL
+	// spaces, and characters that prevent or allow breaks around them
+	breakSP
+	breakZW
+	breakZWJ
+	breakWJ
+	breakGL
+	breakCM
+	// punctuation
+	breakBA
+	breakBB
+	breakB2
+	breakHY
+	breakOP
+	breakCL
+	breakCP
+	breakEX
+	breakIS
+	breakSY
+	breakQU
+	breakNS
+	breakIN
+	breakPR
+	breakPO
+	// letters, numbers, and ideographs
+	breakAL
+	breakNU
+	breakID
+)
+
+// lineBreak is a position in a piece of text, as a byte offset, at which a
+// line may be broken, or at which it must be broken if mandatory is set
+type lineBreak struct {
+	offset    int
+	mandatory bool
+}
+
+// breakClassOf returns the line breaking class of a character, after the
+// classes that the algorithm does not resolve itself have been mapped onto
+// the classes above (rule LB1)
+func breakClassOf(char rune) breakClass {
+	switch char {
+	case '\n':
+		return breakLF
+	case '\r':
+		return breakCR
+	case '\u0085':
+		return breakNL
+	case '\v', '\f', '\u2028', '\u2029':
+		return breakBK
+	case ' ':
+		return breakSP
+	case '\u200B':
+		return breakZW
+	case '\u200D':
+		return breakZWJ
+	case '\u2060', '\uFEFF':
+		return breakWJ
+	case '\u00A0', '\u202F', '\u2007', '‑', '\u180E', '\u034F':
+		return breakGL
+	case '\t', '|', '\u00AD', '֊', '\u1680', '‐', '‒', '–', '‧', '\u205F', '\u3000':
+		return breakBA
+	case '´', 'ˈ', 'ˌ', '˟':
+		return breakBB
+	case '—':
+		return breakB2
+	case '-':
+		return breakHY
+	case '(', '[', '{', '¡', '¿', '‚', '„', '⁅', '⁽', '₍',
+		'〈', '《', '「', '『', '【', '〔', '〖', '〘', '〚', '〝',
+		'（', '［', '｛', '｟', '｢':
+		return breakOP
+	case '}', '⁆', '⁾', '₎',
+		'、', '。', '〉', '》', '」', '』', '】', '〕', '〗', '〙', '〛', '〞', '〟',
+		'﹐', '﹒', '）', '，', '．', '］', '｝', '｠', '｡', '｣', '､':
+		return breakCL
+	case ')', ']':
+		return breakCP
+	case '!', '?', '׆', '؟', '！', '？':
+		return breakEX
+	case ',', '.', ':', ';', '\u037E', '։', '،', '؍', '߸', '⁄', '︐', '︓', '︔':
+		return breakIS
+	case '/':
+		return breakSY
+	case '"', '\'', '«', '»', '‘', '’', '‛', '“', '”', '‟', '‹', '›', '❛', '❜', '❝', '❞':
+		return breakQU
+	case '‼', '‽', '⁇', '⁈', '⁉', '々', '〜', '〻', '〼',
+		'゛', '゜', 'ゝ', 'ゞ', '゠', '・', 'ー', 'ヽ', 'ヾ',
+		'：', '；', '･', 'ｰ', 'ﾞ', 'ﾟ':
+		return breakNS
+	case '․', '‥', '…', '︙':
+		return breakIN
+	case '$', '+', '\\', '£', '¥', '±', '№', '−', '∓', '﹩', '＄', '￡', '￥', '￦':
+		return breakPR
+	case '%', '¢', '°', '‰', '‱', '′', '″', '‴', '‵', '‶', '‷', '℃', '℉', '﹪', '％', '￠':
+		return breakPO
+	}
+
+	switch {
+	case char >= '\u2000' && char <= '\u200A':
+		// the spaces of various widths, other than the figure space, which is
+		// handled above
+		return breakBA
+	case char >= '₠' && char <= '⃏':
+		// currency symbols
+		return breakPR
+	case isSmallKana(char):
+		// conditional Japanese starters are treated as non-starters, which is
+		// the usual (strict) style for Japanese
+		return breakNS
+	case char >= '\U0001F3FB' && char <= '\U0001F3FF':
+		// emoji modifiers stay attached to the emoji that they modify
+		return breakCM
+	case unicode.In(char, unicode.Mn, unicode.Me, unicode.Mc):
+		return breakCM
+	case unicode.IsControl(char):
+		return breakCM
+	case unicode.IsDigit(char) && !(char >= '０' && char <= '９'):
+		return breakNU
+	case isIdeographic(char):
+		return breakID
+	default:
+		return breakAL
+	}
+}
+
+func isSmallKana(char rune) bool {
+	switch char {
+	case 'ぁ', 'ぃ', 'ぅ', 'ぇ', 'ぉ', 'っ', 'ゃ', 'ゅ', 'ょ', 'ゎ', 'ゕ', 'ゖ',
+		'ァ', 'ィ', 'ゥ', 'ェ', 'ォ', 'ッ', 'ャ', 'ュ', 'ョ', 'ヮ', 'ヵ', 'ヶ':
+		return true
+	}
+	return (char >= 'ㇰ' && char <= 'ㇿ') || (char >= 'ｧ' && char <= 'ｯ')
+}
+
+// isIdeographic reports whether a character is one of the ideographs, kana,
+// syllables, or symbols between which CJK text can be broken
+func isIdeographic(char rune) bool {
+	if unicode.In(char, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+		return true
+	}
+
+	switch {
+	case char >= '⺀' && char <= '⿿':
+		// CJK and Kangxi radicals, ideographic description characters
+		return true
+	case char >= '\u3000' && char <= '㏿':
+		// CJK symbols, enclosed letters and compatibility characters
+		return true
+	case char >= '！' && char <= '｠':
+		// fullwidth forms
+		return true
+	case char >= '\U0001F000' && char <= '\U0001FAFF':
+		// emoji and pictographs
+		return true
+	case char >= '\U00020000' && char <= '\U0003FFFD':
+		// supplementary ideographic planes
+		return true
+	}
+
+	return false
+}
+
+// isHardBreak reports whether the class is one after which a line must be
+// broken
+func isHardBreak(class breakClass) bool {
+	return class == breakBK || class == breakCR || class == breakLF || class == breakNL
+}
+
+// lineBreaks returns every position in the text at which a line may be
+// broken, in order.  The end of the text is always a mandatory break.
+func lineBreaks(text string) []lineBreak {
+	breaks := make([]lineBreak, 0)
+
+	// the class of the previous character, once combining marks have been
+	// merged into the character that they belong to
+	var prev breakClass
+	// the class of the last character before the current run of spaces, for
+	// the rules that apply across spaces
+	var base breakClass
+	// whether the previous character was a zero width joiner
+	joined := false
+
+	for offset, char := range text {
+		class := breakClassOf(char)
+
+		if offset == 0 {
+			// LB2: never break at the start of text
+			if class == breakCM || class == breakZWJ {
+				// LB10: combining marks with nothing to combine with are
+				// treated as letters
+				class = breakAL
+			}
+			joined = char == '\u200D'
+			prev, base = class, class
+			continue
+		}
+
+		// LB4, LB5: always break after hard line breaks, but keep CR LF
+		// together
+		if isHardBreak(prev) && !(prev == breakCR && class == breakLF) {
+			breaks = append(breaks, lineBreak{offset, true})
+		} else if lineBreakAllowed(prev, base, class, joined) {
+			breaks = append(breaks, lineBreak{offset, false})
+		}
+
+		joined = char == '\u200D'
+
+		if class == breakCM || class == breakZWJ {
+			switch prev {
+			case breakBK, breakCR, breakLF, breakNL, breakSP, breakZW:
+				// LB10
+				class = breakAL
+			default:
+				// LB9: combining marks take the class of the character that
+				// they belong to
+				continue
+			}
+		}
+
+		prev = class
+		if class != breakSP {
+			base = class
+		}
+	}
+
+	return append(breaks, lineBreak{len(text), true})
+}
+
+// lineBreakAllowed applies the rules from LB6 onwards, and reports whether a
+// line may be broken between a character of the class prev and one of the
+// class next.  base is the class of the last character before any spaces
+// that separate them, and joined is set if prev is a zero width joiner.
+func lineBreakAllowed(prev breakClass, base breakClass, next breakClass, joined bool) bool {
+	isOneOf := func(class breakClass, classes ...breakClass) bool {
+		for _, c := range classes {
+			if class == c {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	// LB6: do not break before hard line breaks
+	case isHardBreak(next):
+		return false
+	// LB7: do not break before spaces or zero width spaces
+	case next == breakSP || next == breakZW:
+		return false
+	// LB8: break after zero width spaces, even when followed by spaces
+	case base == breakZW:
+		return true
+	// LB8a: do not break after a zero width joiner
+	case joined:
+		return false
+	// LB9: do not break before combining marks
+	case next == breakCM || next == breakZWJ:
+		return false
+	// LB11: do not break before or after word joiners
+	case next == breakWJ || prev == breakWJ:
+		return false
+	// LB12: do not break after non-breaking characters
+	case prev == breakGL:
+		return false
+	// LB12a: do not break before non-breaking characters, except after
+	// spaces and hyphens
+	case next == breakGL && !isOneOf(prev, breakSP, breakBA, breakHY):
+		return false
+	// LB13: do not break before closing punctuation, even after spaces
+	case isOneOf(next, breakCL, breakCP, breakEX, breakIS, breakSY):
+		return false
+	// LB14: do not break after opening punctuation, even after spaces
+	case base == breakOP:
+		return false
+	// LB15: do not break within a quotation mark followed by opening
+	// punctuation, even with spaces in between
+	case base == breakQU && next == breakOP:
+		return false
+	// LB16: do not break between closing punctuation and a non-starter, even
+	// with spaces in between
+	case isOneOf(base, breakCL, breakCP) && next == breakNS:
+		return false
+	// LB17: do not break within a pair of em dashes, even with spaces in
+	// between
+	case base == breakB2 && next == breakB2:
+		return false
+	// LB18: break after spaces
+	case prev == breakSP:
+		return true
+	// LB19: do not break before or after quotation marks
+	case next == breakQU || prev == breakQU:
+		return false
+	// LB21: do not break before hyphens, small kana, and other non-starters,
+	// or after acute accents
+	case isOneOf(next, breakBA, breakHY, breakNS) || prev == breakBB:
+		return false
+	// LB22: do not break before ellipses
+	case next == breakIN:
+		return false
+	// LB23: do not break between digits and letters
+	case (prev == breakAL && next == breakNU) || (prev == breakNU && next == breakAL):
+		return false
+	// LB23a: do not break between numeric prefixes and ideographs, or between
+	// ideographs and numeric postfixes
+	case (prev == breakPR && next == breakID) || (prev == breakID && next == breakPO):
+		return false
+	// LB24: do not break between numeric prefixes or postfixes and letters
+	case (isOneOf(prev, breakPR, breakPO) && next == breakAL) || (prev == breakAL && isOneOf(next, breakPR, breakPO)):
+		return false
+	// LB25: do not break within numbers, e.g. "$(12.35)", "-5" or "50%"
+	case isOneOf(prev, breakCL, breakCP, breakNU) && isOneOf(next, breakPO, breakPR),
+		isOneOf(prev, breakPO, breakPR) && next == breakOP,
+		isOneOf(prev, breakPO, breakPR, breakHY, breakIS, breakNU, breakSY) && next == breakNU:
+		return false
+	// LB28: do not break between letters
+	case prev == breakAL && next == breakAL:
+		return false
+	// LB29: do not break between numeric punctuation and letters, e.g. "e.g."
+	case prev == breakIS && next == breakAL:
+		return false
+	// LB30: do not break between letters or numbers and parentheses
+	case (isOneOf(prev, breakAL, breakNU) && next == breakOP) || (prev == breakCP && isOneOf(next, breakAL, breakNU)):
+		return false
+	// LB31: break everywhere else
+	default:
+		return true
+	}
+}
+
+// isLineEnd reports whether a character is dropped from the end of a line
+// when the line is measured or drawn, i.e. the spaces and hard line breaks at
+// which lines are broken
+func isLineEnd(char rune) bool {
+	switch breakClassOf(char) {
+	case breakSP, breakZW, breakBK, breakCR, breakLF, breakNL:
+		return true
+	default:
+		return false
+	}
+}
+
+// trimLineEnd removes the spaces and hard line breaks from the end of a line
+func trimLineEnd(line string) string {
+	return line[:lineContentEnd(line, 0, len(line))]
+}
+
+// lineContentEnd returns the offset in the text at which the visible part of
+// the line between start and end ends
+func lineContentEnd(text string, start int, end int) int {
+	for end > start {
+		char, size := utf8.DecodeLastRuneInString(text[start:end])
+		if !isLineEnd(char) {
+			break
+		}
+		end -= size
+	}
+	return end
+}
+
+// endsParagraph reports whether a line ends in a hard line break, and so is
+// the last line of a paragraph
+func endsParagraph(line string) bool {
+	for end := len(line); end > 0; {
+		char, size := utf8.DecodeLastRuneInString(line[:end])
+		if isHardBreak(breakClassOf(char)) {
+			return true
+		}
+		if !isLineEnd(char) {
+			return false
+		}
+		end -= size
+	}
+	return false
+}
+
+// wrapText breaks text into lines that are no wider than maxWidth, and
+// returns the offset at which each line ends, so that the lines together
+// cover the whole text.  measure returns the width of text[start:end].  Each
+// line ends with the spaces or hard line break at which it was broken, which
+// do not count towards its width.  There is always at least one line, even if
+// the text is empty.
+func wrapText(text string, maxWidth Size, measure func(start int, end int) Size) []int {
+	ends := make([]int, 0)
+	lineStart := 0
+	// the end of the last break opportunity that fits onto the current line
+	lineEnd := 0
+
+	for _, opportunity := range lineBreaks(text) {
+		fits := func() bool {
+			return measure(lineStart, lineContentEnd(text, lineStart, opportunity.offset)) <= maxWidth
+		}
+
+		if lineEnd > lineStart && !fits() {
+			ends = append(ends, lineEnd)
+			lineStart = lineEnd
+		}
+
+		// a word that does not fit onto a line of its own is broken wherever
+		// it has to be
+		for !fits() {
+			cut := forcedLineBreak(text, lineStart, opportunity.offset, maxWidth, measure)
+			if cut >= lineContentEnd(text, lineStart, opportunity.offset) {
+				// a single character that is wider than the line has to
+				// overflow it
+				break
+			}
+			ends = append(ends, cut)
+			lineStart = cut
+		}
+
+		lineEnd = opportunity.offset
+		if opportunity.mandatory {
+			ends = append(ends, lineEnd)
+			lineStart = lineEnd
+		}
+	}
+
+	return ends
+}
+
+// forcedLineBreak returns the offset of the last character boundary between
+// start and end at which the text still fits into maxWidth, keeping at least
+// one character on the line.  Combining marks are never separated from the
+// character that they belong to.
+func forcedLineBreak(text string, start int, end int, maxWidth Size, measure func(start int, end int) Size) int {
+	result := -1
+	joined := false
+
+	for offset, char := range text[start:end] {
+		class := breakClassOf(char)
+		boundary := offset > 0 && class != breakCM && class != breakZWJ && !joined
+		joined = class == breakZWJ
+
+		if !boundary {
+			continue
+		}
+
+		if result != -1 && measure(start, start+offset) > maxWidth {
+			break
+		}
+		result = start + offset
+	}
+
+	if result == -1 {
+		// the whole segment is a single character
+		return end
+	}
+
+	return result
+}
@@ -0,0 +1,122 @@
+package docspec
+
+import (
+	"reflect"
+	"testing"
+	"unicode/utf8"
+)
+
+// markBreaks marks every break in the text other than the one at its end
+// with "|", or with "!" if it's mandatory
+func markBreaks(text string) string {
+	marked := ""
+	start := 0
+	for _, opportunity := range lineBreaks(text) {
+		marked += text[start:opportunity.offset]
+		start = opportunity.offset
+		if opportunity.offset == len(text) {
+			break
+		}
+		if opportunity.mandatory {
+			marked += "!"
+		} else {
+			marked += "|"
+		}
+	}
+	return marked
+}
+
+func TestLineBreaks(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{"empty", "", ""},
+		{"after spaces", "the quick  brown", "the |quick  |brown"},
+		{"after hard line breaks", "one\ntwo\r\nthree", "one\n!two\r\n!three"},
+		{"after hyphens", "well-known", "well-|known"},
+		{"not before closing punctuation", "(yes) no. Maybe!", "(yes) |no. |Maybe!"},
+		{"not inside numbers", "1,000.50 each", "1,000.50 |each"},
+		{"not at a no-break space", "10\u00a0km away", "10\u00a0km |away"},
+		{"not before combining marks", "cafe\u0301 au lait", "cafe\u0301 |au |lait"},
+		{"not inside emoji modifier sequences", "👍🏽 ok", "👍🏽 |ok"},
+		{"between ideographs", "漢字かな", "漢|字|か|な"},
+		{"not before small kana", "キャット", "キャッ|ト"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if marked := markBreaks(test.text); marked != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, marked)
+			}
+
+			breaks := lineBreaks(test.text)
+			if last := breaks[len(breaks)-1]; last.offset != len(test.text) || !last.mandatory {
+				t.Errorf("expected a mandatory break at the end of the text, got %+v", last)
+			}
+		})
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	// every character is 1 wide
+	wrap := func(text string, maxWidth Size) []string {
+		ends := wrapText(text, maxWidth, func(start int, end int) Size {
+			return Size(utf8.RuneCountInString(text[start:end]))
+		})
+
+		lines := make([]string, 0, len(ends))
+		start := 0
+		for _, end := range ends {
+			lines = append(lines, text[start:end])
+			start = end
+		}
+		return lines
+	}
+
+	tests := []struct {
+		name     string
+		text     string
+		maxWidth Size
+		expected []string
+	}{
+		{"empty text has one line", "", 10, []string{""}},
+		{"text that fits", "the quick", 10, []string{"the quick"}},
+		{"lines keep the spaces at which they are broken", "the quick brown fox", 10, []string{"the quick ", "brown fox"}},
+		{"trailing spaces don't count towards the width", "abcd    efgh", 4, []string{"abcd    ", "efgh"}},
+		{"hard line breaks", "a\nb c", 10, []string{"a\n", "b c"}},
+		{"blank lines", "a\n\nb", 10, []string{"a\n", "\n", "b"}},
+		{"words longer than a line are broken anywhere", "abcdefghij klm", 4, []string{"abcd", "efgh", "ij ", "klm"}},
+		{"combining marks stay with their character", "e\u0301e\u0301e\u0301", 3, []string{"e\u0301", "e\u0301", "e\u0301"}},
+		{"ideographs", "漢字かな漢字", 4, []string{"漢字かな", "漢字"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if lines := wrap(test.text, test.maxWidth); !reflect.DeepEqual(lines, test.expected) {
+				t.Errorf("expected %q, got %q", test.expected, lines)
+			}
+		})
+	}
+}
+
+func TestEndsParagraph(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected bool
+	}{
+		{"the end\n", true},
+		{"the end\r\n", true},
+		{"the end\n  ", true},
+		{"the middle ", false},
+		{"the middle", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if ends := endsParagraph(test.line); ends != test.expected {
+			t.Errorf("%q: expected %t, got %t", test.line, test.expected, ends)
+		}
+	}
+}
@@ -0,0 +1,926 @@
+package docspec
+
+import (
+	"math"
+	"strings"
+)
+
+/*
+Functions for splitting layout nodes over page boundaries.
+
+A node that does not fit in the space left on a page is cut into two
+fragments: a "head", which fits into the space that is left, and a "tail",
+which continues at the top of the next page (and which may itself be split
+again).  Each fragment is a copy of the original node that repeats its
+borders, fill and padding, but the margins of the original node only apply at
+the outer edges, i.e. the top margin on the head and the bottom margin on the
+tail.
+*/
+
+// layoutEpsilon is the tolerance used when comparing sizes, so that floating
+// point error doesn't push a node that fits exactly onto the next page.
+const layoutEpsilon Size = 1e-9
+
+// freezeNodeSizes resolves the width and height of every node in the tree
+// below (and including) the given node, and replaces each future with a
+// static size.  Once a tree is split into fragments, the fragments no longer
+// share the parent and sibling relationships that the original futures were
+// defined in terms of, so we pin the sizes that the tree had as a whole before
+// we start cutting it up.  The returned function puts the original futures
+// back, for when the tree ends up being moved on to the next page whole, where
+// its sizes have to be measured again.
+func freezeNodeSizes(node *LayoutNode) (func(), error) {
+	type frozenSize struct {
+		node   *LayoutNode
+		width  Size
+		height Size
+		grid   *GridProps
+	}
+
+	// resolve everything first, and only then replace the futures, so that
+	// no future is ever evaluated against a half-frozen tree
+	sizes := make([]frozenSize, 0)
+
+	var collect func(n *LayoutNode) error
+	collect = func(n *LayoutNode) error {
+		rect, err := n.getRenderRect()
+		if err != nil {
+			return err
+		}
+		frozen := frozenSize{n, rect.width, rect.height, n.grid}
+
+		if n.grid != nil {
+			// the tracks of a grid are measured in terms of its children,
+			// which are about to become static themselves
+			frozen.grid, err = n.staticGridProps()
+			if err != nil {
+				return err
+			}
+		}
+		sizes = append(sizes, frozen)
+
+		for _, child := range n.Children {
+			err := collect(child)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err := collect(node)
+	if err != nil {
+		return nil, err
+	}
+
+	type originalSize struct {
+		width  Future
+		height Future
+		grid   *GridProps
+	}
+
+	originals := make([]originalSize, len(sizes))
+	for idx, s := range sizes {
+		originals[idx] = originalSize{s.node.Width, s.node.Height, s.node.grid}
+
+		s.node.Width = StaticSize(s.width)
+		s.node.Height = StaticSize(s.height)
+		s.node.grid = s.grid
+		s.node.bindFutures()
+	}
+	// the layout cached for each grid was worked out from its original tracks
+	node.invalidateSizes()
+
+	thaw := func() {
+		for idx, s := range sizes {
+			s.node.Width = originals[idx].width
+			s.node.Height = originals[idx].height
+			s.node.grid = originals[idx].grid
+			s.node.bindFutures()
+		}
+		node.invalidateSizes()
+	}
+
+	return thaw, nil
+}
+
+// splitChildren distributes a list of sibling nodes flowing from top to bottom
+// into the list of nodes that fit into the available height, and the list of
+// nodes that must continue on the next page.  The node straddling the
+// boundary is split into fragments where possible.  The returned size is the
+// height taken up by the nodes in the head list, including the gap between
+// each of them.
+//
+// When force is set, the content is being placed at the top of an empty page,
+// so keep-together and keep-with-next are ignored rather than leaving the
+// content with nowhere to go.
+func splitChildren(children []*LayoutNode, available Size, gap Size, force bool) ([]*LayoutNode, []*LayoutNode, Size, error) {
+	head := make([]*LayoutNode, 0)
+	used := emptySize
+	// the number of nodes in the head that are in the normal flow
+	flowing := 0
+
+	for idx, child := range children {
+		if child.isOutOfFlow() {
+			// the node doesn't take up any space, so it stays with the
+			// siblings that come before it
+			head = append(head, child)
+			continue
+		}
+
+		// a forced break before the child only makes sense if there is
+		// something above it, otherwise we would just create a blank page
+		if flowing > 0 && hasLeadingBreak(child) {
+			return head, children[idx:], used, nil
+		}
+
+		height, err := child.getBoundingHeight()
+		if err != nil {
+			return nil, nil, emptySize, err
+		}
+
+		// the space between the child and the previous one in the head
+		before := emptySize
+		if flowing > 0 {
+			before = gap
+		}
+
+		if used+before+height <= available+layoutEpsilon && !hasInteriorBreak(child) {
+			head = append(head, child)
+			used += before + height
+			flowing++
+
+			if idx != len(children)-1 && hasTrailingBreak(child) {
+				return head, children[idx+1:], used, nil
+			}
+			continue
+		}
+
+		// the child doesn't fit, so we have to break it up
+		thaw, err := freezeNodeSizes(child)
+		if err != nil {
+			return nil, nil, emptySize, err
+		}
+
+		childHead, childTail, err := splitNode(child, available-used-before, force)
+		if err != nil {
+			return nil, nil, emptySize, err
+		}
+
+		if childHead == nil && childTail == child {
+			// the child moves on to the next page whole, where it is measured
+			// again rather than keeping the sizes it had on this page
+			thaw()
+		}
+
+		tail := make([]*LayoutNode, 0, len(children)-idx)
+
+		if childHead != nil {
+			headHeight, err := childHead.getBoundingHeight()
+			if err != nil {
+				return nil, nil, emptySize, err
+			}
+			head = append(head, childHead)
+			used += before + headHeight
+			flowing++
+		} else if !force {
+			// nothing of the child fits on this page, so pull any preceding
+			// siblings that must be kept with their next sibling along with
+			// it onto the next page
+			for len(head) > 0 && head[len(head)-1].KeepWithNext && !head[len(head)-1].isOutOfFlow() {
+				last := head[len(head)-1]
+				lastHeight, err := last.getBoundingHeight()
+				if err != nil {
+					return nil, nil, emptySize, err
+				}
+
+				head = head[:len(head)-1]
+				used -= lastHeight
+				flowing--
+				if flowing > 0 {
+					used -= gap
+				}
+				tail = append([]*LayoutNode{last}, tail...)
+			}
+		}
+
+		if childTail != nil {
+			tail = append(tail, childTail)
+		}
+		tail = append(tail, children[idx+1:]...)
+
+		return head, tail, used, nil
+	}
+
+	return head, nil, used, nil
+}
+
+// splitNode splits a node whose sizes have been frozen into a head fragment
+// with a bounding height no greater than the available height, and a tail
+// fragment containing the rest of the node.  A nil head means that no part
+// of the node fits in the available height, and a nil tail means that the
+// entire node fits.  See splitChildren for the meaning of force.
+func splitNode(node *LayoutNode, available Size, force bool) (*LayoutNode, *LayoutNode, error) {
+	boundingHeight, err := node.getBoundingHeight()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	interiorBreak := hasInteriorBreak(node)
+
+	if boundingHeight <= available+layoutEpsilon && !interiorBreak {
+		return node, nil, nil
+	}
+
+	drawHeight, err := node.getDrawHeight()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the bottom margin is dropped at a page break, so a node that only
+	// overflows because of its bottom margin is placed whole
+	if boundingHeight-node.Margin.bottom <= available+layoutEpsilon && !interiorBreak {
+		head := node.newHeadFragment(drawHeight)
+		for _, child := range node.Children {
+			head.adoptChild(child)
+		}
+		return head, nil, nil
+	}
+
+	// explicit page breaks take precedence over keeping the node together
+	if node.KeepTogether && !interiorBreak && !force {
+		return nil, node, nil
+	}
+
+	// every fragment repeats the padding, so the space available for content
+	// is whatever is left after the head's top margin and padding
+	contentAvailable := available - node.Margin.top - node.Padding.top - node.Padding.bottom
+	if contentAvailable <= 0 {
+		return nil, node, nil
+	}
+
+	if textNode, ok := textLeaf(node); ok {
+		return splitTextNode(node, textNode, drawHeight, contentAvailable)
+	}
+
+	if richTextNode, ok := richTextLeaf(node); ok {
+		return splitRichTextNode(node, richTextNode, drawHeight, contentAvailable)
+	}
+
+	if node.VisualNode != nil {
+		// visual nodes other than text (e.g. images) are atomic
+		return nil, node, nil
+	}
+
+	if len(node.Children) == 0 {
+		// there is no content to split an empty box between, so it is moved
+		// to the next page as a whole
+		return nil, node, nil
+	}
+
+	if node.grid != nil {
+		return splitGrid(node, drawHeight, contentAvailable)
+	}
+
+	switch node.ChildFlowDirection {
+	case FlowHorizontal:
+		if node.ChildWrap {
+			return splitWrappedRow(node, drawHeight, contentAvailable)
+		}
+		return splitRow(node, drawHeight, contentAvailable, force)
+	default:
+		return splitColumn(node, drawHeight, contentAvailable, force)
+	}
+}
+
+// splitColumn splits a node whose children flow from top to bottom, by moving
+// the children that don't fit into the tail fragment.
+func splitColumn(node *LayoutNode, drawHeight Size, contentAvailable Size, force bool) (*LayoutNode, *LayoutNode, error) {
+	headChildren, tailChildren, used, err := splitChildren(node.Children, contentAvailable, node.RowGap, force)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(inFlow(headChildren)) == 0 {
+		return nil, node, nil
+	}
+
+	tailContentHeight := totalGap(node.RowGap, len(inFlow(tailChildren)))
+	for _, child := range inFlow(tailChildren) {
+		h, err := child.getBoundingHeight()
+		if err != nil {
+			return nil, nil, err
+		}
+		tailContentHeight += h
+	}
+
+	if len(tailChildren) == 0 {
+		// everything fit, but the node itself is taller than the page, so
+		// the head runs to the end of the page and the tail is just the
+		// remainder of the box
+		headHeight, tail := node.boxRemainder(drawHeight, contentAvailable)
+		head := node.newHeadFragment(headHeight)
+		for _, child := range headChildren {
+			head.adoptChild(child)
+		}
+		return head, tail, nil
+	}
+
+	head := node.newHeadFragment(used)
+	for _, child := range headChildren {
+		head.adoptChild(child)
+	}
+
+	// the gap between the children on either side of the break is dropped
+	remaining := drawHeight - used
+	if len(inFlow(tailChildren)) > 0 {
+		remaining -= node.RowGap
+	}
+	tail := node.newTailFragment(math.Max(remaining, tailContentHeight))
+	for _, child := range tailChildren {
+		tail.adoptChild(child)
+	}
+
+	return head, tail, nil
+}
+
+// splitRow splits a node whose children flow from left to right, by splitting
+// every child at the same height.  Children that have nothing left to render
+// on one side of the split are replaced by empty spacers so that the columns
+// of the row stay in place.  Explicit page breaks inside of a row are ignored,
+// since all of the children in the row share the same lines on the page.
+func splitRow(node *LayoutNode, drawHeight Size, contentAvailable Size, force bool) (*LayoutNode, *LayoutNode, error) {
+	headChildren := make([]*LayoutNode, 0, len(node.Children))
+	tailChildren := make([]*LayoutNode, 0, len(node.Children))
+
+	hasHeadContent := false
+	hasTailContent := false
+	headContentHeight := emptySize
+	tailContentHeight := emptySize
+
+	for _, child := range node.Children {
+		if child.isOutOfFlow() {
+			// positioned children stay with the start of the row
+			headChildren = append(headChildren, child)
+			continue
+		}
+
+		childHead, childTail, err := splitNode(child, contentAvailable, force)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if childHead != nil {
+			h, err := childHead.getBoundingHeight()
+			if err != nil {
+				return nil, nil, err
+			}
+			hasHeadContent = true
+			headContentHeight = math.Max(headContentHeight, h)
+			headChildren = append(headChildren, childHead)
+		} else {
+			headChildren = append(headChildren, child.newSpacer())
+		}
+
+		if childTail != nil {
+			h, err := childTail.getBoundingHeight()
+			if err != nil {
+				return nil, nil, err
+			}
+			hasTailContent = true
+			tailContentHeight = math.Max(tailContentHeight, h)
+			tailChildren = append(tailChildren, childTail)
+		} else {
+			tailChildren = append(tailChildren, child.newSpacer())
+		}
+	}
+
+	if !hasHeadContent {
+		return nil, node, nil
+	}
+
+	// as with columns, if the content all fits then only the box itself
+	// continues on the next page
+	if !hasTailContent {
+		headHeight, tail := node.boxRemainder(drawHeight, contentAvailable)
+		head := node.newHeadFragment(headHeight)
+		for _, child := range headChildren {
+			head.adoptChild(child)
+		}
+		if tail != nil {
+			for _, child := range tailChildren {
+				tail.adoptChild(child)
+			}
+		}
+		return head, tail, nil
+	}
+
+	head := node.newHeadFragment(headContentHeight)
+	for _, child := range headChildren {
+		head.adoptChild(child)
+	}
+
+	tail := node.newTailFragment(math.Max(drawHeight-headContentHeight, tailContentHeight))
+	for _, child := range tailChildren {
+		tail.adoptChild(child)
+	}
+
+	return head, tail, nil
+}
+
+// splitWrappedRow splits a node whose children wrap onto multiple lines, by
+// moving the lines that don't fit into the tail fragment.  Lines are never
+// split themselves.
+func splitWrappedRow(node *LayoutNode, drawHeight Size, contentAvailable Size) (*LayoutNode, *LayoutNode, error) {
+	lines, err := node.wrapLines()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	used := emptySize
+	fit := 0
+	for idx, line := range lines {
+		tallest, err := tallestBoundingHeight(line)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		before := emptySize
+		if idx > 0 {
+			before = node.RowGap
+		}
+
+		if used+before+tallest > contentAvailable+layoutEpsilon {
+			break
+		}
+
+		used += before + tallest
+		fit++
+	}
+
+	if fit == 0 {
+		return nil, node, nil
+	}
+
+	if fit == len(lines) {
+		// the lines all fit, but the box around them doesn't
+		headHeight, tail := node.boxRemainder(drawHeight, contentAvailable)
+		head := node.newHeadFragment(headHeight)
+		for _, child := range node.Children {
+			head.adoptChild(child)
+		}
+		return head, tail, nil
+	}
+
+	head := node.newHeadFragment(used)
+	for _, line := range lines[:fit] {
+		for _, child := range line {
+			head.adoptChild(child)
+		}
+	}
+	head.adoptOutOfFlowChildren(node)
+
+	tailContentHeight := totalGap(node.RowGap, len(lines)-fit)
+	for _, line := range lines[fit:] {
+		tallest, err := tallestBoundingHeight(line)
+		if err != nil {
+			return nil, nil, err
+		}
+		tailContentHeight += tallest
+	}
+
+	// the gap between the lines on either side of the break is dropped
+	tail := node.newTailFragment(math.Max(drawHeight-used-node.RowGap, tailContentHeight))
+	for _, line := range lines[fit:] {
+		for _, child := range line {
+			tail.adoptChild(child)
+		}
+	}
+
+	return head, tail, nil
+}
+
+// splitGrid splits a grid between its rows, by moving the rows that don't fit
+// into the tail fragment, or the rows after a forced page break.  The grid can
+// only be split between rows that no child spans across, and rows are never
+// split themselves.  Both fragments keep the track sizes that the grid had as
+// a whole, so that the columns line up across the page break.
+func splitGrid(node *LayoutNode, drawHeight Size, contentAvailable Size) (*LayoutNode, *LayoutNode, error) {
+	areas, rowCount := node.gridAreas()
+	breaks := node.gridBreaks()
+
+	// the tracks have already been frozen to static sizes
+	rows, err := node.gridTrackSizes(FlowVertical, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// find the last row boundary that both fits and isn't spanned by a child
+	fit := 0
+	used := emptySize
+	position := emptySize
+	for boundary := 1; boundary <= rowCount; boundary++ {
+		if boundary > 1 {
+			position += node.RowGap
+		}
+		position += rows[boundary-1]
+		if position > contentAvailable+layoutEpsilon {
+			break
+		}
+
+		if !isGridRowSpanned(areas, boundary) {
+			fit = boundary
+			used = position
+
+			if breaks[boundary] {
+				break
+			}
+		}
+	}
+
+	if fit == 0 {
+		return nil, node, nil
+	}
+
+	if fit == rowCount {
+		// the rows all fit, but the box around them doesn't
+		headHeight, tail := node.boxRemainder(drawHeight, contentAvailable)
+		head := node.newHeadFragment(headHeight)
+		for _, child := range node.Children {
+			head.adoptChild(child)
+		}
+		return head, tail, nil
+	}
+
+	head := node.newHeadFragment(used)
+	head.grid = &GridProps{Columns: node.grid.Columns, Rows: node.grid.Rows[:fit]}
+
+	tailContentHeight := totalGap(node.RowGap, rowCount-fit)
+	for _, size := range rows[fit:] {
+		tailContentHeight += size
+	}
+
+	// the gap between the rows on either side of the break is dropped
+	tail := node.newTailFragment(math.Max(drawHeight-used-node.RowGap, tailContentHeight))
+	tail.grid = &GridProps{Columns: node.grid.Columns, Rows: node.grid.Rows[fit:]}
+
+	// children are placed explicitly in the fragments, since automatic
+	// placement would fill the rows differently without the rest of the grid
+	for idx, child := range node.flowChildren() {
+		area := areas[idx]
+		child.GridColumn = area.column + 1
+		child.GridColumnSpan = area.columnSpan
+		child.GridRowSpan = area.rowSpan
+
+		if area.row < fit {
+			child.GridRow = area.row + 1
+			head.adoptChild(child)
+		} else {
+			child.GridRow = area.row - fit + 1
+			tail.adoptChild(child)
+		}
+	}
+	head.adoptOutOfFlowChildren(node)
+
+	return head, tail, nil
+}
+
+// splitTextNode splits a text leaf between its wrapped lines.
+func splitTextNode(node *LayoutNode, textNode TextNode, drawHeight Size, contentAvailable Size) (*LayoutNode, *LayoutNode, error) {
+	if textNode.OverflowBehavior == overflowTruncate {
+		return nil, node, nil
+	}
+
+	width, err := node.getDrawWidth()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lines := node.rendererContext.SplitText(Rect{width, math.MaxFloat64}, textNode)
+	lineHeight := textNode.getLineHeightMM()
+
+	fit := int(math.Floor((contentAvailable + layoutEpsilon) / lineHeight))
+	if fit <= 0 {
+		return nil, node, nil
+	}
+
+	if fit >= len(lines) {
+		// all of the text fits, but the box around it doesn't
+		textNode.Text = joinTextLines(lines)
+		headHeight, tail := node.boxRemainder(drawHeight, contentAvailable)
+		head := node.newTextFragment(textNode, headHeight)
+		head.Margin.bottom = emptySize
+		return head, tail, nil
+	}
+
+	headHeight := float64(fit) * lineHeight
+	tailHeight := math.Max(drawHeight-headHeight, float64(len(lines)-fit)*lineHeight)
+
+	headText := textNode
+	headText.Text = joinTextLines(lines[:fit])
+	headText.continued = true
+	head := node.newTextFragment(headText, headHeight)
+	head.Margin.bottom = emptySize
+	tailText := textNode
+	tailText.Text = joinTextLines(lines[fit:])
+	tail := node.newTextFragment(tailText, tailHeight)
+	tail.Margin.top = emptySize
+
+	return head, tail, nil
+}
+
+// splitRichTextNode splits a rich text leaf between its wrapped lines, which
+// may each have a different height.
+func splitRichTextNode(node *LayoutNode, richTextNode RichTextNode, drawHeight Size, contentAvailable Size) (*LayoutNode, *LayoutNode, error) {
+	if richTextNode.OverflowBehavior == overflowTruncate {
+		return nil, node, nil
+	}
+
+	width, err := node.getDrawWidth()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lines := node.rendererContext.SplitRichText(Rect{width, math.MaxFloat64}, richTextNode)
+
+	fit := 0
+	headHeight := emptySize
+	for _, line := range lines {
+		lineHeight := richTextNode.getLineHeightMM(line)
+		if headHeight+lineHeight > contentAvailable+layoutEpsilon {
+			break
+		}
+		headHeight += lineHeight
+		fit++
+	}
+
+	if fit == 0 {
+		return nil, node, nil
+	}
+
+	if fit >= len(lines) {
+		// all of the text fits, but the box around it doesn't
+		headHeight, tail := node.boxRemainder(drawHeight, contentAvailable)
+		head := node.newTextFragment(richTextNode, headHeight)
+		head.Margin.bottom = emptySize
+		return head, tail, nil
+	}
+
+	// the lines keep the spaces at which they were broken, so the spans of
+	// each part wrap the same way again at the same width
+	headText := richTextNode
+	headText.Spans = flattenTextLines(lines[:fit])
+	headText.continued = true
+	tailText := richTextNode
+	tailText.Spans = flattenTextLines(lines[fit:])
+
+	tailHeight := emptySize
+	for _, line := range lines[fit:] {
+		tailHeight += richTextNode.getLineHeightMM(line)
+	}
+	tailHeight = math.Max(drawHeight-headHeight, tailHeight)
+
+	head := node.newTextFragment(headText, headHeight)
+	head.Margin.bottom = emptySize
+	tail := node.newTextFragment(tailText, tailHeight)
+	tail.Margin.top = emptySize
+
+	return head, tail, nil
+}
+
+// joinTextLines reassembles wrapped lines into a piece of text that will wrap
+// the same way again when rendered at the same width.  The lines keep the
+// spaces or line break at which they were broken, so this is the text that
+// they were split from.
+func joinTextLines(lines []string) string {
+	return strings.Join(lines, "")
+}
+
+// textLeaf reports whether the node is the layout node created by the `Text`
+// constructor, returning the wrapped text node if it is.
+func textLeaf(node *LayoutNode) (TextNode, bool) {
+	if len(node.Children) != 1 {
+		return TextNode{}, false
+	}
+
+	textNode, ok := node.Children[0].VisualNode.(TextNode)
+	return textNode, ok
+}
+
+// richTextLeaf reports whether the node is the layout node created by the
+// `RichText` constructor, returning the wrapped rich text node if it is.
+func richTextLeaf(node *LayoutNode) (RichTextNode, bool) {
+	if len(node.Children) != 1 {
+		return RichTextNode{}, false
+	}
+
+	richTextNode, ok := node.Children[0].VisualNode.(RichTextNode)
+	return richTextNode, ok
+}
+
+// ---------------------------- Page break rules -----------------------------
+
+/*
+Forced page breaks are honored between the children of columns, and between
+the rows of grids, at any depth of the tree.  The children of a row, whether it
+wraps or not, share the same lines on the page, so page breaks requested by
+them or anywhere inside of them are ignored.  Grid rows are never split, so
+page breaks in the middle of the children of a grid are ignored too.
+*/
+
+// hasLeadingBreak reports whether a page break is requested before the node.
+// A break before the first child of a column (or a child in the first row of
+// a grid) is a break before the node itself.
+func hasLeadingBreak(node *LayoutNode) bool {
+	if node.PageBreakBefore {
+		return true
+	}
+
+	if node.grid != nil {
+		return node.gridBreaks()[0]
+	}
+
+	if node.ChildFlowDirection == FlowVertical && len(node.Children) > 0 {
+		return hasLeadingBreak(node.Children[0])
+	}
+
+	return false
+}
+
+// hasTrailingBreak reports whether a page break is requested after the node.
+// A break after the last child of a column (or a child in the last row of a
+// grid) is a break after the node itself.
+func hasTrailingBreak(node *LayoutNode) bool {
+	if node.PageBreakAfter {
+		return true
+	}
+
+	if node.grid != nil {
+		_, rowCount := node.gridAreas()
+		return node.gridBreaks()[rowCount]
+	}
+
+	if node.ChildFlowDirection == FlowVertical && len(node.Children) > 0 {
+		return hasTrailingBreak(node.Children[len(node.Children)-1])
+	}
+
+	return false
+}
+
+// hasInteriorBreak reports whether a page break is requested somewhere in
+// the middle of the node's tree, meaning that the node must be split even if
+// it would otherwise fit on the page.
+func hasInteriorBreak(node *LayoutNode) bool {
+	if node.grid != nil {
+		// the rows of a grid are never split, so only the breaks between
+		// rows count
+		areas, rowCount := node.gridAreas()
+		for boundary := range node.gridBreaks() {
+			if boundary > 0 && boundary < rowCount && !isGridRowSpanned(areas, boundary) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if node.ChildFlowDirection != FlowVertical {
+		return false
+	}
+
+	for idx, child := range node.Children {
+		if idx != 0 && hasLeadingBreak(child) {
+			return true
+		}
+
+		if idx != len(node.Children)-1 && hasTrailingBreak(child) {
+			return true
+		}
+
+		if hasInteriorBreak(child) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// gridBreaks returns the row boundaries of a grid at which a page break is
+// requested, either before a child at the top of its area, or after a child
+// at the bottom of its area.  Boundary n is the top of the row at index n, so
+// 0 is the top of the grid and the number of rows is the bottom.
+func (n *LayoutNode) gridBreaks() map[int]bool {
+	areas, _ := n.gridAreas()
+	breaks := make(map[int]bool)
+
+	for idx, child := range n.flowChildren() {
+		if hasLeadingBreak(child) {
+			breaks[areas[idx].row] = true
+		}
+		if hasTrailingBreak(child) {
+			breaks[areas[idx].row+areas[idx].rowSpan] = true
+		}
+	}
+
+	return breaks
+}
+
+// isGridRowSpanned reports whether any area spans across the given row
+// boundary, in which case the grid cannot be split there
+func isGridRowSpanned(areas []gridArea, boundary int) bool {
+	for _, area := range areas {
+		if area.row < boundary && area.row+area.rowSpan > boundary {
+			return true
+		}
+	}
+	return false
+}
+
+// -------------------------- Fragment constructors --------------------------
+
+// newFragment creates a copy of the node without any children, to be used as
+// a piece of the original node once it is split.
+func (n *LayoutNode) newFragment(drawHeight Size) *LayoutNode {
+	fragment := *n
+	fragment.Children = make([]*LayoutNode, 0)
+	fragment.Page = nil
+	// the original node's height constraints apply to the node as a whole,
+	// not to each fragment
+	fragment.MinHeight = emptySize
+	fragment.MaxHeight = emptySize
+	fragment.Height = StaticSize(drawHeight + n.Padding.top + n.Padding.bottom)
+	fragment.bindFutures()
+	// a grid fragment only holds some of the original grid's children
+	fragment.gridLayout = nil
+
+	return &fragment
+}
+
+// newHeadFragment creates the fragment of the node that ends at a page break
+func (n *LayoutNode) newHeadFragment(drawHeight Size) *LayoutNode {
+	fragment := n.newFragment(drawHeight)
+	fragment.Margin.bottom = emptySize
+	return fragment
+}
+
+// newTailFragment creates the fragment of the node that starts after a page
+// break
+func (n *LayoutNode) newTailFragment(drawHeight Size) *LayoutNode {
+	fragment := n.newFragment(drawHeight)
+	fragment.Margin.top = emptySize
+	return fragment
+}
+
+// boxRemainder returns the content height of the head fragment of a node whose
+// content all fits into the available height, but whose box doesn't, along
+// with the tail fragment holding the rest of the box.  The tail is nil if
+// nothing of the box is left over for the next page.
+func (n *LayoutNode) boxRemainder(drawHeight Size, contentAvailable Size) (Size, *LayoutNode) {
+	if drawHeight <= contentAvailable+layoutEpsilon {
+		return drawHeight, nil
+	}
+
+	return contentAvailable, n.newTailFragment(drawHeight - contentAvailable)
+}
+
+// newTextFragment creates a fragment of a text or rich text leaf which renders
+// the given visual node, holding only part of the original text.
+func (n *LayoutNode) newTextFragment(visualNode interface{}, drawHeight Size) *LayoutNode {
+	fragment := n.newFragment(drawHeight)
+
+	wrapper := n.Children[0]
+
+	wrapperFragment := *wrapper
+	wrapperFragment.Children = make([]*LayoutNode, 0)
+	wrapperFragment.VisualNode = visualNode
+	wrapperFragment.Height = StaticSize(drawHeight)
+	wrapperFragment.bindFutures()
+
+	fragment.adoptChild(&wrapperFragment)
+	return fragment
+}
+
+// adoptOutOfFlowChildren moves the children of the original node that are out
+// of the normal flow into the fragment.  Since they don't take up any space,
+// they always stay with the first fragment of the node.
+func (n *LayoutNode) adoptOutOfFlowChildren(original *LayoutNode) {
+	for _, child := range original.Children {
+		if child.isOutOfFlow() {
+			n.adoptChild(child)
+		}
+	}
+}
+
+// newSpacer creates an empty, invisible node with the same width as the
+// original node.
+func (n *LayoutNode) newSpacer() *LayoutNode {
+	spacer := n.newFragment(emptySize)
+	spacer.Height = StaticSize(emptySize)
+	spacer.Margin.top = emptySize
+	spacer.Margin.bottom = emptySize
+	spacer.VisualNode = nil
+	spacer.Border = BooleanQuad{}
+	spacer.ShowFill = false
+	spacer.bindFutures()
+
+	return spacer
+}
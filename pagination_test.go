@@ -0,0 +1,376 @@
+package docspec
+
+import (
+	"strings"
+	"testing"
+)
+
+// column creates a top level div sized as its children, containing a box of
+// each of the given heights
+func column(props LayoutNodeProps, heights ...Size) *LayoutNode {
+	props.Width = WidthFill()
+	props.Height = HeightAsChildren()
+	return Div(nil, props, func(parent *LayoutNode) {
+		for _, height := range heights {
+			Div(parent, LayoutNodeProps{Width: WidthFill(), Height: StaticSize(height)}, NoChildren)
+		}
+	})
+}
+
+func TestSplitNodesOverPages(t *testing.T) {
+	const width = 195.9
+
+	tests := []struct {
+		name     string
+		nodes    func() []*LayoutNode
+		expected [][]testRect
+	}{
+		{
+			name: "node that fits is placed whole",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{box(100, LayoutNodeProps{})}
+			},
+			expected: [][]testRect{{{10, 10, width, 100}}},
+		},
+		{
+			name: "node that only overflows by its bottom margin is placed whole",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{
+					box(150, LayoutNodeProps{}),
+					box(100, LayoutNodeProps{Border: NewSingletonBooleanQuad(true), Margin: NewSizeQuad(0, 0, 20, 0)}),
+				}
+			},
+			expected: [][]testRect{{{10, 10, width, 150}, {10, 160, width, 100}}},
+		},
+		{
+			name: "box with children that only overflows by its bottom margin is placed whole",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{
+					box(150, LayoutNodeProps{}),
+					Div(nil, LayoutNodeProps{Width: WidthFill(), Height: StaticSize(100), Margin: NewSizeQuad(0, 0, 20, 0)}, func(parent *LayoutNode) {
+						Div(parent, LayoutNodeProps{Width: WidthFill(), Height: StaticSize(50)}, NoChildren)
+					}),
+				}
+			},
+			expected: [][]testRect{{{10, 10, width, 150}, {10, 160, width, 100}}},
+		},
+		{
+			name: "nodes after a bottom margin at a page break start the next page",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{
+					box(150, LayoutNodeProps{}),
+					box(100, LayoutNodeProps{Margin: NewSizeQuad(0, 0, 20, 0)}),
+					box(10, LayoutNodeProps{}),
+				}
+			},
+			expected: [][]testRect{
+				{{10, 10, width, 150}, {10, 160, width, 100}},
+				{{10, 10, width, 10}},
+			},
+		},
+		{
+			name: "column is split between its children",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{column(LayoutNodeProps{}, 100, 100, 100)}
+			},
+			expected: [][]testRect{{{10, 10, width, 200}}, {{10, 10, width, 100}}},
+		},
+		{
+			name: "fragments repeat the padding but only the outer margins",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{column(LayoutNodeProps{Padding: NewSingletonSizeQuad(5), Margin: NewSizeQuad(10, 0, 10, 0)}, 100, 100, 100)}
+			},
+			expected: [][]testRect{{{10, 20, width, 210}}, {{10, 10, width, 110}}},
+		},
+		{
+			name: "box taller than its content continues on the next page",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{Div(nil, LayoutNodeProps{Width: WidthFill(), Height: StaticSize(300)}, func(parent *LayoutNode) {
+					Div(parent, LayoutNodeProps{Width: WidthFill(), Height: StaticSize(50)}, NoChildren)
+				})}
+			},
+			expected: [][]testRect{{{10, 10, width, 259.4}}, {{10, 10, width, 40.6}}},
+		},
+		{
+			name: "grid is split between its rows",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{Grid(nil, LayoutNodeProps{Width: WidthFill(), Height: HeightAsChildren()}, GridProps{Columns: []GridTrack{TrackFraction(1), TrackFraction(1)}}, func(parent *LayoutNode) {
+					cell(parent, 100, LayoutNodeProps{})
+					cell(parent, 50, LayoutNodeProps{})
+					cell(parent, 100, LayoutNodeProps{})
+					cell(parent, 100, LayoutNodeProps{})
+					cell(parent, 100, LayoutNodeProps{})
+				})}
+			},
+			expected: [][]testRect{{{10, 10, width, 200}}, {{10, 10, width, 100}}},
+		},
+		{
+			name: "grid row taller than the space left starts the next page",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{
+					box(200, LayoutNodeProps{}),
+					Grid(nil, LayoutNodeProps{Width: WidthFill(), Height: HeightAsChildren()}, GridProps{Columns: []GridTrack{TrackFraction(1)}}, func(parent *LayoutNode) {
+						cell(parent, 40, LayoutNodeProps{})
+						cell(parent, 40, LayoutNodeProps{})
+					}),
+				}
+			},
+			expected: [][]testRect{{{10, 10, width, 200}, {10, 210, width, 40}}, {{10, 10, width, 40}}},
+		},
+		{
+			name: "gap at a break between the children of a column is dropped",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{column(LayoutNodeProps{RowGap: 10}, 100, 100, 100)}
+			},
+			expected: [][]testRect{{{10, 10, width, 210}}, {{10, 10, width, 100}}},
+		},
+		{
+			name: "gap at a break between the lines of a wrapping row is dropped",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{Div(nil, LayoutNodeProps{Width: WidthFill(), Height: HeightAsChildren(), ChildFlowDirection: FlowHorizontal, ChildWrap: true, RowGap: 10}, func(parent *LayoutNode) {
+					for idx := 0; idx < 3; idx++ {
+						Div(parent, LayoutNodeProps{Width: StaticSize(150), Height: StaticSize(100)}, NoChildren)
+					}
+				})}
+			},
+			expected: [][]testRect{{{10, 10, width, 210}}, {{10, 10, width, 100}}},
+		},
+		{
+			name: "gap at a break between the rows of a grid is dropped",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{Grid(nil, LayoutNodeProps{Width: WidthFill(), Height: HeightAsChildren(), RowGap: 10}, GridProps{Columns: []GridTrack{TrackFraction(1)}}, func(parent *LayoutNode) {
+					cell(parent, 100, LayoutNodeProps{})
+					cell(parent, 100, LayoutNodeProps{})
+					cell(parent, 100, LayoutNodeProps{})
+				})}
+			},
+			expected: [][]testRect{{{10, 10, width, 210}}, {{10, 10, width, 100}}},
+		},
+		{
+			name: "top level fill takes the space left on the page",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{
+					box(100, LayoutNodeProps{}),
+					Div(nil, LayoutNodeProps{Width: WidthFill(), Height: HeightFill()}, NoChildren),
+				}
+			},
+			expected: [][]testRect{{{10, 10, width, 100}, {10, 110, width, 159.4}}},
+		},
+		{
+			name: "top level fill takes the space left on a continuation page",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{
+					box(200, LayoutNodeProps{}),
+					box(100, LayoutNodeProps{}),
+					Div(nil, LayoutNodeProps{Width: WidthFill(), Height: HeightFill()}, NoChildren),
+				}
+			},
+			expected: [][]testRect{
+				{{10, 10, width, 200}},
+				{{10, 10, width, 100}, {10, 110, width, 159.4}},
+			},
+		},
+		{
+			name: "top level fill after a fill that took the whole page fills the next page",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{
+					Div(nil, LayoutNodeProps{Width: WidthFill(), Height: HeightFill()}, NoChildren),
+					Div(nil, LayoutNodeProps{Width: WidthFill(), Height: HeightFill()}, NoChildren),
+				}
+			},
+			expected: [][]testRect{{{10, 10, width, 259.4}}, {{10, 10, width, 259.4}}},
+		},
+		{
+			name: "top level fill that moves to the next page is measured again there",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{
+					box(200, LayoutNodeProps{}),
+					Div(nil, LayoutNodeProps{Width: WidthFill(), Height: HeightFill(), MinHeight: 100}, NoChildren),
+				}
+			},
+			expected: [][]testRect{{{10, 10, width, 200}}, {{10, 10, width, 259.4}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assertPageRects(t, layoutNodes(t, test.nodes()...), test.expected)
+		})
+	}
+}
+
+func TestSplitTextOverPages(t *testing.T) {
+	text := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 200)
+	node := Text(nil, LayoutNodeProps{Width: WidthFill(), Height: HeightAsChildren()}, TextNode{Text: text, FontSize: 12})
+	document := layoutNodes(t, node)
+
+	if len(document.Children) < 2 {
+		t.Fatalf("expected the text to run over several pages, got %d", len(document.Children))
+	}
+
+	fragments := make([]string, 0)
+	for idx, page := range document.Children {
+		if len(page.Children) != 1 {
+			t.Fatalf("expected one fragment on page %d, got %d", idx+1, len(page.Children))
+		}
+
+		fragment, ok := textLeaf(page.Children[0])
+		if !ok {
+			t.Fatalf("expected a text fragment on page %d", idx+1)
+		}
+		fragments = append(fragments, fragment.Text)
+
+		rect := rectOf(t, page.Children[0])
+		if rect.y+rect.height > page.Height-page.Margin.bottom+layoutEpsilon {
+			t.Errorf("fragment on page %d runs past the bottom of the page: %+v", idx+1, rect)
+		}
+	}
+
+	if strings.Join(fragments, "") != text {
+		t.Errorf("the fragments don't add up to the original text")
+	}
+}
+
+// cell creates a grid child with a static height that fills its area
+func cell(parent *LayoutNode, height Size, props LayoutNodeProps) *LayoutNode {
+	props.Width = WidthFill()
+	props.Height = StaticSize(height)
+	return Div(parent, props, NoChildren)
+}
+
+func TestPageBreakRules(t *testing.T) {
+	const width = 195.9
+
+	tests := []struct {
+		name     string
+		nodes    func() []*LayoutNode
+		expected [][]testRect
+	}{
+		{
+			name: "break before a top level node",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{box(50, LayoutNodeProps{}), box(50, LayoutNodeProps{PageBreakBefore: true})}
+			},
+			expected: [][]testRect{{{10, 10, width, 50}}, {{10, 10, width, 50}}},
+		},
+		{
+			name: "break before the first node doesn't leave a blank page",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{box(50, LayoutNodeProps{PageBreakBefore: true})}
+			},
+			expected: [][]testRect{{{10, 10, width, 50}}},
+		},
+		{
+			name: "break before a child of a column",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{Div(nil, LayoutNodeProps{Width: WidthFill(), Height: HeightAsChildren()}, func(parent *LayoutNode) {
+					cell(parent, 50, LayoutNodeProps{})
+					cell(parent, 50, LayoutNodeProps{PageBreakBefore: true})
+					cell(parent, 50, LayoutNodeProps{})
+				})}
+			},
+			expected: [][]testRect{{{10, 10, width, 50}}, {{10, 10, width, 100}}},
+		},
+		{
+			name: "break after a child of a nested column",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{Div(nil, LayoutNodeProps{Width: WidthFill(), Height: HeightAsChildren()}, func(parent *LayoutNode) {
+					Div(parent, LayoutNodeProps{Width: WidthFill(), Height: HeightAsChildren()}, func(parent *LayoutNode) {
+						cell(parent, 50, LayoutNodeProps{PageBreakAfter: true})
+						cell(parent, 50, LayoutNodeProps{})
+					})
+				})}
+			},
+			expected: [][]testRect{{{10, 10, width, 50}}, {{10, 10, width, 50}}},
+		},
+		{
+			name: "break after the last child of a column breaks after the column",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{
+					Div(nil, LayoutNodeProps{Width: WidthFill(), Height: HeightAsChildren()}, func(parent *LayoutNode) {
+						cell(parent, 50, LayoutNodeProps{})
+						cell(parent, 50, LayoutNodeProps{PageBreakAfter: true})
+					}),
+					box(50, LayoutNodeProps{}),
+				}
+			},
+			expected: [][]testRect{{{10, 10, width, 100}}, {{10, 10, width, 50}}},
+		},
+		{
+			name: "break between the rows of a grid",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{Grid(nil, LayoutNodeProps{Width: WidthFill(), Height: HeightAsChildren()}, GridProps{Columns: []GridTrack{TrackFraction(1)}}, func(parent *LayoutNode) {
+					cell(parent, 50, LayoutNodeProps{})
+					cell(parent, 50, LayoutNodeProps{PageBreakBefore: true})
+					cell(parent, 50, LayoutNodeProps{})
+				})}
+			},
+			expected: [][]testRect{{{10, 10, width, 50}}, {{10, 10, width, 100}}},
+		},
+		{
+			name: "break after the last row of a grid breaks after the grid",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{
+					Grid(nil, LayoutNodeProps{Width: WidthFill(), Height: HeightAsChildren()}, GridProps{Columns: []GridTrack{TrackFraction(1), TrackFraction(1)}}, func(parent *LayoutNode) {
+						cell(parent, 50, LayoutNodeProps{})
+						cell(parent, 50, LayoutNodeProps{PageBreakAfter: true})
+					}),
+					box(50, LayoutNodeProps{}),
+				}
+			},
+			expected: [][]testRect{{{10, 10, width, 50}}, {{10, 10, width, 50}}},
+		},
+		{
+			name: "break across a spanned grid row is ignored",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{Grid(nil, LayoutNodeProps{Width: WidthFill(), Height: HeightAsChildren()}, GridProps{Columns: []GridTrack{TrackFraction(1), TrackFraction(1)}}, func(parent *LayoutNode) {
+					cell(parent, 100, LayoutNodeProps{GridRowSpan: 2})
+					cell(parent, 50, LayoutNodeProps{})
+					cell(parent, 50, LayoutNodeProps{PageBreakBefore: true})
+				})}
+			},
+			expected: [][]testRect{{{10, 10, width, 100}}},
+		},
+		{
+			name: "break inside a row is ignored",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{Div(nil, LayoutNodeProps{Width: WidthFill(), Height: HeightAsChildren(), ChildFlowDirection: FlowHorizontal}, func(parent *LayoutNode) {
+					cell(parent, 50, LayoutNodeProps{})
+					cell(parent, 50, LayoutNodeProps{PageBreakBefore: true})
+				})}
+			},
+			expected: [][]testRect{{{10, 10, width, 50}}},
+		},
+		{
+			name: "keep together moves the node to the next page",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{box(200, LayoutNodeProps{}), column(LayoutNodeProps{KeepTogether: true}, 50, 50)}
+			},
+			expected: [][]testRect{{{10, 10, width, 200}}, {{10, 10, width, 100}}},
+		},
+		{
+			name: "keep together is ignored for a node taller than a page",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{column(LayoutNodeProps{KeepTogether: true}, 200, 200)}
+			},
+			expected: [][]testRect{{{10, 10, width, 200}}, {{10, 10, width, 200}}},
+		},
+		{
+			name: "keep with next moves a heading along with the next node",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{
+					box(200, LayoutNodeProps{}),
+					box(20, LayoutNodeProps{KeepWithNext: true}),
+					box(50, LayoutNodeProps{KeepTogether: true}),
+				}
+			},
+			expected: [][]testRect{{{10, 10, width, 200}}, {{10, 10, width, 20}, {10, 30, width, 50}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assertPageRects(t, layoutNodes(t, test.nodes()...), test.expected)
+		})
+	}
+}
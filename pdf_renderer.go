@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"reflect"
 	"strings"
 
@@ -34,20 +35,22 @@ type FontConfig struct {
 	File  string
 }
 
-func documentSizeToRendererString(s documentSize) string {
-	switch s {
-	case DocumentSizeLetter:
-		return "Letter"
-	}
-
-	return ""
-}
-
 // NewPDFRenderer creates a new renderer that will render the document tree
-// into a PDF.  The first font in the list of FontConfig objects will
+// into a PDF.  The first font in the list of FontConfig objects will be used
+// as the default font.  The document size is only used as the default page
+// size of the PDF, as each page is rendered at the size of the corresponding
+// page in the document.
 func NewPDFRenderer(ds documentSize, fontsDir string, fonts ...FontConfig) (*PDFRenderer, error) {
-	pdf := gofpdf.New("P", "mm", documentSizeToRendererString(ds), "")
+	width, height := getDocumentSize(ds)
+	pdf := gofpdf.NewCustom(&gofpdf.InitType{
+		OrientationStr: "P",
+		UnitStr:        "mm",
+		Size:           gofpdf.SizeType{Wd: width, Ht: height},
+	})
 	pdf.SetFontLocation(fontsDir)
+	// page breaks are entirely managed by the layout engine, so we never want
+	// FPDF to insert pages of its own when we draw near the bottom of a page
+	pdf.SetAutoPageBreak(false, 0)
 
 	if len(fonts) == 0 {
 		return nil, errors.New("must provide at least one font to render a PDF")
@@ -70,14 +73,11 @@ func NewPDFRenderer(ds documentSize, fontsDir string, fonts ...FontConfig) (*PDF
 	return renderer, nil
 }
 
-func (r *PDFRenderer) walkAndDrawChildren(node *LayoutNode) error {
-	for _, child := range node.Children {
-		err := r.drawDiv(child)
-		if err != nil {
-			return err
-		}
-
-		err = r.walkAndDrawChildren(child)
+// drawInPaintOrder draws the trees below the given nodes, painting the nodes
+// in stacking order (see `paintOrder`)
+func (r *PDFRenderer) drawInPaintOrder(nodes []*LayoutNode) error {
+	for _, node := range paintOrder(nodes) {
+		err := r.drawDiv(node)
 		if err != nil {
 			return err
 		}
@@ -91,29 +91,50 @@ func (r *PDFRenderer) walkAndDrawChildren(node *LayoutNode) error {
 func (r *PDFRenderer) Render(document *Document) (result interface{}, err error) {
 	pdf := r.pdf
 	for _, page := range document.Children {
-		pdf.AddPage()
-		for _, node := range page.Children {
-			r.drawDiv(node)
-			err := r.walkAndDrawChildren(node)
+		pdf.AddPageFormat("P", gofpdf.SizeType{Wd: page.Width, Ht: page.Height})
+		err := r.drawInPaintOrder(page.Children)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, decoration := range []*LayoutNode{page.Header, page.Footer} {
+			if decoration == nil {
+				continue
+			}
+
+			err := r.drawInPaintOrder(decoration.Children)
 			if err != nil {
 				return nil, err
 			}
 		}
 	}
+
+	// anything else that gofpdf failed to draw is recorded on the document
+	// rather than returned from the call that failed
+	if r.pdf.Err() {
+		return nil, r.pdf.Error()
+	}
+
 	return r.pdf, nil
 }
 
 // GetInherentTextRect uses the calculated line height in MM and the underlying
 // FPDF's GetStringWidth function to get the width and height that a text would
-// have if unwrapped using the current font properties.
+// have if unwrapped using the current font properties, including the margin
+// on either side of the lines.  Text with hard line breaks is as wide as its
+// widest line.
 func (r *PDFRenderer) GetInherentTextRect(textNode TextNode) Rect {
-	height := textNode.getLineHeightMM()
+	lines := r.SplitText(Rect{math.MaxFloat64, math.MaxFloat64}, textNode)
+
 	r.setAttributesForTextNode(textNode)
-	width := r.pdf.GetStringWidth(textNode.Text) + 1
+	width := emptySize
+	for _, line := range lines {
+		width = math.Max(width, r.pdf.GetStringWidth(visibleText(trimLineEnd(line))))
+	}
 
 	return Rect{
-		width,
-		height,
+		width + 2*r.pdf.GetCellMargin(),
+		textNode.getLineHeightMM() * Size(len(lines)),
 	}
 }
 
@@ -133,18 +154,18 @@ func (r *PDFRenderer) drawDiv(node *LayoutNode) error {
 	r.pdf.SetXY(node.X, node.Y)
 	r.setDrawColor(node.BorderColor)
 
+	// nodes without a fill are transparent, so that they don't hide anything
+	// painted below them
 	if node.ShowFill {
 		r.setFillColor(node.FillColor)
-	} else {
-		r.setFillColor(white)
 	}
 
-	width, err := node.Width.await()
+	width, err := node.getWidth()
 	if err != nil {
 		return err
 	}
 
-	height, err := node.Height.await()
+	height, err := node.getHeight()
 	if err != nil {
 		return err
 	}
@@ -183,15 +204,14 @@ func (r *PDFRenderer) drawDiv(node *LayoutNode) error {
 func (r *PDFRenderer) drawVisualNode(visualNode interface{}, parentNode *LayoutNode) error {
 	switch visualNode.(type) {
 	case TextNode:
-		r.drawTextNode(visualNode.(TextNode), parentNode)
-		break
+		return r.drawTextNode(visualNode.(TextNode), parentNode)
+	case RichTextNode:
+		return r.drawRichTextNode(visualNode.(RichTextNode), parentNode)
 	case ImageNode:
-		r.drawImageNode(visualNode.(ImageNode), parentNode)
+		return r.drawImageNode(visualNode.(ImageNode), parentNode)
 	default:
-		return fmt.Errorf("PDFRenderer: unhandled visual node type: %s", reflect.TypeOf(visualNode).String())
+		return &UnsupportedVisualNodeError{Path: pathOf(parentNode), Property: "VisualNode", Type: reflect.TypeOf(visualNode).String()}
 	}
-
-	return nil
 }
 
 // returns an FPDF image type based on the file extension
@@ -217,7 +237,7 @@ func imageTypeFromFileName(src string) string {
 func (r *PDFRenderer) drawImageNode(i ImageNode, parentNode *LayoutNode) error {
 	reader, err := i.getBytesReader()
 	if err != nil {
-		return err
+		return &ImageDecodeError{Path: pathOf(parentNode), Property: "VisualNode", Src: i.Src, Err: err}
 	}
 
 	r.pdf.RegisterImageOptionsReader(
@@ -225,6 +245,13 @@ func (r *PDFRenderer) drawImageNode(i ImageNode, parentNode *LayoutNode) error {
 		gofpdf.ImageOptions{ImageType: imageTypeFromFileName(i.Src)},
 		reader,
 	)
+	if r.pdf.Err() {
+		// gofpdf records the failure on the document and silently skips
+		// every call from now on, so clear it and report it here instead
+		err := r.pdf.Error()
+		r.pdf.ClearError()
+		return &ImageDecodeError{Path: pathOf(parentNode), Property: "VisualNode", Src: i.Src, Err: err}
+	}
 
 	parentRect, err := parentNode.getDrawRect()
 	if err != nil {
@@ -233,7 +260,7 @@ func (r *PDFRenderer) drawImageNode(i ImageNode, parentNode *LayoutNode) error {
 
 	drawRect, err := i.getDrawRect(parentRect)
 	if err != nil {
-		return err
+		return &ImageDecodeError{Path: pathOf(parentNode), Property: "VisualNode", Src: i.Src, Err: err}
 	}
 
 	x := parentNode.X
@@ -268,43 +295,222 @@ func (r *PDFRenderer) drawTextNode(t TextNode, parentNode *LayoutNode) error {
 
 	lines := r.SplitText(targetDrawRect, t)
 
-	// TODO(#3): we need a way to split request that the lines start at a
-	// particular point within the text box.  For example, given that the text
-	// is in a "box", we should be able to tell the parent that the children
-	// should have a particular alignment.  Basically, the wrapping text node
-	// is always the full size of the parent draw rect, when in in reality it
-	// should always be width fill and height = children, after we support
-	// heightAsChildren on text nodes.
-
+	printed := lines
 	if t.OverflowBehavior == overflowTruncate {
-		r.printTextLine(lines[0], t)
-	} else {
-		for _, line := range lines {
-			r.printTextLine(line, t)
-		}
+		printed = lines[:1]
+	}
+
+	// the text node is always drawn into the full draw rect of its parent, so
+	// the block of lines is positioned within it.  gofpdf draws the baseline
+	// of each line 0.3 ems below the middle of the line.
+	lineHeight := t.getLineHeightMM()
+	blockHeight := lineHeight * Size(len(printed))
+	lastBaseline := blockHeight - lineHeight/2 + 0.3*t.getFontSizeMM()
+	offset := textBlockOffset(t.VerticalAlignment, targetDrawRect.height, blockHeight, lastBaseline)
+	r.pdf.SetXY(parentNode.X, parentNode.Y+offset)
+
+	for idx, line := range printed {
+		r.printTextLine(line, t, targetDrawRect.width, endsParagraph(line) || (idx == len(printed)-1 && !t.continued))
 	}
 
 	return nil
 }
 
-func (r *PDFRenderer) printTextLine(line string, t TextNode) {
+// textBlockOffset returns the distance from the top of the available height
+// to the top of a block of lines, given the height of the block and the
+// distance from its top to the baseline of its last line
+func textBlockOffset(alignment textVerticalAlignment, available Size, blockHeight Size, lastBaseline Size) Size {
+	offset := emptySize
+	switch alignment {
+	case TextMiddle:
+		offset = (available - blockHeight) / 2
+	case TextBottom:
+		offset = available - blockHeight
+	case TextBaseline:
+		offset = available - lastBaseline
+	}
+
+	// text that does not fit is cut off at the bottom, like top aligned text
+	return math.Max(offset, 0)
+}
+
+// printTextLine prints a single line of a text node at the cursor, aligned
+// within the available width, and moves the cursor to the start of the next
+// line.  Justified lines are stretched to the available width unless they are
+// the last line of the paragraph.
+func (r *PDFRenderer) printTextLine(line string, t TextNode, available Size, last bool) {
 	startX := r.pdf.GetX()
 	startY := r.pdf.GetY()
+
+	// lines are split after the space between words or at a line break,
+	// which must not count towards the width of the line when it is aligned
+	line = visibleText(trimLineEnd(line))
+	cellMargin := r.pdf.GetCellMargin()
+	width := r.pdf.GetStringWidth(line) + 2*cellMargin
+
+	x := startX + textLineOffset(t.Alignment, available, width)
+	wordSpacing := emptySize
+	if t.Alignment == TextJustify && !last {
+		wordSpacing = justifiedWordSpacing(available, width, strings.Count(line, " "))
+		if wordSpacing != emptySize {
+			width = available
+		}
+	}
+
+	if wordSpacing != emptySize {
+		// gofpdf only applies word spacing to single byte fonts, which are
+		// the only fonts that the renderer loads
+		r.pdf.SetWordSpacing(wordSpacing)
+		defer r.pdf.SetWordSpacing(0)
+	}
+
+	r.pdf.SetXY(x, startY)
 	r.pdf.CellFormat(
-		r.pdf.GetStringWidth(line), // width
-		t.getLineHeightMM(),        // height
-		line,                       // text string (NA)
-		"",                         // border string
-		0,                          // cursor position after draw (NA)
-		"",                         // text alignment (NA)
-		false,                      // show fill?
-		0,                          // link id (not supported)
-		t.Link,                     // link str
+		width,               // width
+		t.getLineHeightMM(), // height
+		line,                // text string (NA)
+		"",                  // border string
+		0,                   // cursor position after draw (NA)
+		"",                  // text alignment (NA)
+		false,               // show fill?
+		0,                   // link id (not supported)
+		t.Link,              // link str
 	)
-	r.pdf.SetX(startX)
 	r.pdf.SetXY(startX, startY+t.getLineHeightMM())
 }
 
+// textLineOffset returns the distance from the start of the available width
+// to the start of a line of the given width, according to the alignment of
+// the text.  Justified lines start at the left edge.
+func textLineOffset(alignment textAlignment, available Size, width Size) Size {
+	switch alignment {
+	case TextCenter:
+		return math.Max((available-width)/2, 0)
+	case TextRight:
+		return math.Max(available-width, 0)
+	default:
+		return emptySize
+	}
+}
+
+// justifiedWordSpacing returns the space to add to each of the spaces in a
+// line of the given width in order to stretch it to the available width
+func justifiedWordSpacing(available Size, width Size, spaces int) Size {
+	if spaces == 0 || width >= available {
+		return emptySize
+	}
+	return (available - width) / Size(spaces)
+}
+
+func (r *PDFRenderer) drawRichTextNode(t RichTextNode, parentNode *LayoutNode) error {
+	targetDrawRect, err := parentNode.getDrawRect()
+	if err != nil {
+		return err
+	}
+
+	lines := r.SplitRichText(targetDrawRect, t)
+	if len(lines) == 0 {
+		return nil
+	}
+
+	printed := lines
+	if t.OverflowBehavior == overflowTruncate {
+		printed = lines[:1]
+	}
+
+	blockHeight := emptySize
+	for _, line := range printed {
+		blockHeight += t.getLineHeightMM(line)
+	}
+	lastLine := printed[len(printed)-1]
+	lastBaseline := blockHeight - t.getLineHeightMM(lastLine) + t.getBaselineMM(lastLine)
+
+	y := parentNode.Y + textBlockOffset(t.VerticalAlignment, targetDrawRect.height, blockHeight, lastBaseline)
+	for idx, line := range printed {
+		last := endsParagraph(spansText(line)) || (idx == len(printed)-1 && !t.continued)
+		r.printRichTextLine(line, t, parentNode.X, y, targetDrawRect.width, last)
+		y += t.getLineHeightMM(line)
+	}
+
+	return nil
+}
+
+// printRichTextLine prints a single line of a rich text node with its top at
+// the given point.  Each span on the line is drawn as its own cell, placed so
+// that all of the spans share the baseline of the line.
+func (r *PDFRenderer) printRichTextLine(line []TextSpan, t RichTextNode, x Size, y Size, available Size, last bool) {
+	line = visibleSpans(trimLineEndSpans(line))
+	baseline := y + t.getBaselineMM(line)
+
+	cellMargin := r.pdf.GetCellMargin()
+	widths := make([]Size, len(line))
+	width := 2 * cellMargin
+	spaces := 0
+	for idx, span := range line {
+		r.setAttributesForSpan(span)
+		widths[idx] = r.pdf.GetStringWidth(span.Text)
+		width += widths[idx]
+		spaces += strings.Count(span.Text, " ")
+	}
+
+	x += textLineOffset(t.Alignment, available, width)
+	wordSpacing := emptySize
+	if t.Alignment == TextJustify && !last {
+		wordSpacing = justifiedWordSpacing(available, width, spaces)
+	}
+
+	if wordSpacing != emptySize {
+		r.pdf.SetWordSpacing(wordSpacing)
+		defer r.pdf.SetWordSpacing(0)
+	}
+
+	// the margin is applied once to the whole line rather than to each span
+	r.pdf.SetCellMargin(0)
+	defer r.pdf.SetCellMargin(cellMargin)
+	x += cellMargin
+
+	for idx, span := range line {
+		r.setAttributesForSpan(span)
+		fontSize := span.getFontSizeMM()
+		spanWidth := widths[idx] + wordSpacing*Size(strings.Count(span.Text, " "))
+
+		// a cell of the height of the font has its baseline 0.8 ems from the
+		// top, as it does in every other line that gofpdf draws
+		r.pdf.SetXY(x, baseline-0.8*fontSize)
+		r.pdf.CellFormat(
+			spanWidth, // width
+			fontSize,  // height
+			span.Text, // text string
+			"",        // border string
+			0,         // cursor position after draw (NA)
+			"",        // text alignment (NA)
+			false,     // show fill?
+			0,         // link id (not supported)
+			span.Link, // link str
+		)
+		x += spanWidth
+	}
+}
+
+// trimLineEndSpans removes the spaces or line break at which a line of rich
+// text was broken, which must not count towards the width of the line when it
+// is aligned
+func trimLineEndSpans(line []TextSpan) []TextSpan {
+	trimmed := make([]TextSpan, len(line))
+	copy(trimmed, line)
+
+	for len(trimmed) > 0 {
+		lastIdx := len(trimmed) - 1
+		trimmed[lastIdx].Text = trimLineEnd(trimmed[lastIdx].Text)
+		if trimmed[lastIdx].Text != "" {
+			break
+		}
+		trimmed = trimmed[:lastIdx]
+	}
+
+	return trimmed
+}
+
 // Save outputs the created pdf to a given io.Writer
 func (r *PDFRenderer) Save(renderResult interface{}, writer io.Writer) error {
 	// in this world, renderResult is unused because the fpdf.PDF struct
@@ -313,67 +519,114 @@ func (r *PDFRenderer) Save(renderResult interface{}, writer io.Writer) error {
 		return r.pdf.Error()
 	}
 
-	r.pdf.Output(writer)
-	return nil
+	return r.pdf.Output(writer)
 }
 
-// SplitText calculates the number and size of lines required to render the
-// text node into the given rect.
+// SplitText wraps the text of a text node into as many lines as fit into
+// the given rect.  Lines are broken where the Unicode line breaking algorithm
+// allows it (see linebreak.go), and each line keeps the spaces or line break
+// at which it was broken, so that joining the lines gives back the text.  If
+// the text node is hyphenated, the text has a soft hyphen at every point at
+// which a word may be hyphenated (see hyphenation.go).
 func (r *PDFRenderer) SplitText(targetRect Rect, textNode TextNode) []string {
 	r.setAttributesForTextNode(textNode)
 
-	maxWidth := targetRect.width
-	maxHeight := targetRect.height
-	lineHeight := textNode.getLineHeightMM()
-	currLineHeights := 0.0
-
-	textToGo := strings.TrimSpace(textNode.Text)
+	text := hyphenate(textNode.Text, textNode.Hyphenation)
+	// each line is drawn as a single cell, with a margin on either side
+	maxWidth := targetRect.width - 2*r.pdf.GetCellMargin()
+	ends := wrapText(text, maxWidth, func(start int, end int) Size {
+		return r.pdf.GetStringWidth(visibleText(text[start:end]))
+	})
 
-	currWidth := r.pdf.GetStringWidth(textToGo)
-
-	if currWidth < maxWidth {
-		return []string{textNode.Text}
+	lineHeight := textNode.getLineHeightMM()
+	lines := make([]string, 0, len(ends))
+	start := 0
+	for idx, end := range ends {
+		// lines that don't fit into the rect are cut off, but there is always
+		// at least one line
+		if idx > 0 && Size(idx+1)*lineHeight > targetRect.height+layoutEpsilon {
+			break
+		}
+		lines = append(lines, text[start:end])
+		start = end
 	}
 
-	// basically use binary search to find the right width for each line...
-	results := make([]string, 0)
+	return lines
+}
 
-	wordDelimiter := byte(' ')
+// SplitRichText wraps the spans of a rich text node into as many lines as fit
+// into the given rect, breaking the text of all of the spans as a single
+// paragraph in the same way as SplitText.
+func (r *PDFRenderer) SplitRichText(targetRect Rect, richTextNode RichTextNode) [][]TextSpan {
+	spans := richTextNode.Spans
+	text := spansText(spans)
+
+	// each line is drawn as a single cell, with a margin on either side
+	maxWidth := targetRect.width - 2*r.pdf.GetCellMargin()
+	ends := wrapText(text, maxWidth, func(start int, end int) Size {
+		return r.getSpansWidth(visibleSpans(sliceSpans(spans, start, end)))
+	})
+
+	lines := make([][]TextSpan, 0, len(ends))
+	linesHeight := emptySize
+	start := 0
+	for idx, end := range ends {
+		line := sliceSpans(spans, start, end)
+		linesHeight += richTextNode.getLineHeightMM(line)
+		// lines that don't fit into the rect are cut off, but there is always
+		// at least one line
+		if idx > 0 && linesHeight > targetRect.height+layoutEpsilon {
+			break
+		}
+		lines = append(lines, line)
+		start = end
+	}
 
-	for {
-		currWidth := r.pdf.GetStringWidth(textToGo)
+	return lines
+}
 
-		multiplier := maxWidth / currWidth
+// GetInherentRichTextRect gets the width and height that a rich text node
+// would have if it was drawn without wrapping, including the margin on
+// either side of the lines.
+func (r *PDFRenderer) GetInherentRichTextRect(richTextNode RichTextNode) Rect {
+	lines := r.SplitRichText(Rect{math.MaxFloat64, math.MaxFloat64}, richTextNode)
 
-		if multiplier > 1 {
-			if currLineHeights+lineHeight > maxHeight {
-				return results
-			}
-			results = append(results, textToGo)
-			return results
-		}
-
-		idealCharCount := int(float64(len(textToGo)) * multiplier)
+	result := Rect{}
+	for _, line := range lines {
+		result.width = math.Max(result.width, r.getSpansWidth(visibleSpans(trimLineEndSpans(line))))
+		result.height += richTextNode.getLineHeightMM(line)
+	}
+	result.width += 2 * r.pdf.GetCellMargin()
 
-		// get the string up to idealCharCount, then start chopping until we
-		// get to delimter
-		splitStr := textToGo[:idealCharCount]
-		strLen := len(splitStr)
-		// if the last char is not a word delimiter, truncate the string by a character
-		for (strLen-1 != 0) && splitStr[strLen-1] != wordDelimiter {
-			splitStr = splitStr[:strLen-1]
-			strLen--
-		}
+	return result
+}
 
-		results = append(results, splitStr)
-		currLineHeights += lineHeight
+func (r *PDFRenderer) getSpansWidth(spans []TextSpan) Size {
+	width := emptySize
+	for _, span := range spans {
+		r.setAttributesForSpan(span)
+		width += r.pdf.GetStringWidth(span.Text)
+	}
+	return width
+}
 
-		if currLineHeights+lineHeight > maxHeight {
-			return results
+// sliceSpans returns the parts of the spans that cover the bytes from start
+// to end of the text of all of the spans joined together
+func sliceSpans(spans []TextSpan, start int, end int) []TextSpan {
+	result := make([]TextSpan, 0)
+	spanStart := 0
+	for _, span := range spans {
+		spanEnd := spanStart + len(span.Text)
+		from := int(math.Max(float64(start), float64(spanStart)))
+		to := int(math.Min(float64(end), float64(spanEnd)))
+		if from < to {
+			part := span
+			part.Text = span.Text[from-spanStart : to-spanStart]
+			result = append(result, part)
 		}
-
-		textToGo = strings.Split(textToGo, splitStr)[1]
+		spanStart = spanEnd
 	}
+	return result
 }
 
 func (s fontStyle) toString() string {
@@ -419,3 +672,12 @@ func (r *PDFRenderer) setAttributesForTextNode(textNode TextNode) {
 	r.pdf.SetFont(textNode.FontFamily, textNode.FontStyle.toString(), textNode.FontSize)
 	r.setTextColor(textNode.Color)
 }
+
+func (r *PDFRenderer) setAttributesForSpan(span TextSpan) {
+	style := span.FontStyle.toString()
+	if span.Underline {
+		style += "U"
+	}
+	r.pdf.SetFont(span.FontFamily, style, span.FontSize)
+	r.setTextColor(span.Color)
+}
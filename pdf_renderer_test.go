@@ -0,0 +1,414 @@
+package docspec
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+var errWriteFailed = errors.New("write failed")
+
+// failingWriter is a writer whose every write fails
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errWriteFailed
+}
+
+// brokenImage writes a file that claims to be a PNG, but isn't one
+func brokenImage(t *testing.T) string {
+	t.Helper()
+
+	src := filepath.Join(t.TempDir(), "broken.png")
+	err := os.WriteFile(src, []byte("not a png"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return src
+}
+
+func TestRendererErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		nodes  func(t *testing.T) []*LayoutNode
+		writer io.Writer
+		// layout is set if the error is expected from CreateDocumentTree
+		// rather than from RenderToWriter
+		layout bool
+		check  func(t *testing.T, err error)
+	}{
+		{
+			name: "layout error in the draw rect of a node",
+			nodes: func(t *testing.T) []*LayoutNode {
+				return []*LayoutNode{Div(nil, LayoutNodeProps{ID: "banner", Width: WidthFromAspectRatio(0), Height: StaticSize(10)}, func(parent *LayoutNode) {
+					Div(parent, LayoutNodeProps{Width: StaticSize(10), Height: StaticSize(10)}, NoChildren)
+				})}
+			},
+			layout: true,
+			check: func(t *testing.T, err error) {
+				var invalid *InvalidSizeError
+				if !errors.As(err, &invalid) || invalid.Path.String() != "node(banner)" {
+					t.Errorf("expected an invalid size error for node(banner), got %v", err)
+				}
+			},
+		},
+		{
+			name: "image that gofpdf can't register",
+			nodes: func(t *testing.T) []*LayoutNode {
+				return []*LayoutNode{Image(nil, LayoutNodeProps{ID: "logo", Width: StaticSize(10), Height: StaticSize(10)}, ImageNode{Src: brokenImage(t)})}
+			},
+			check: func(t *testing.T, err error) {
+				var decode *ImageDecodeError
+				if !errors.As(err, &decode) || decode.Path.String() != "node(logo) > node[0]" || decode.Err == nil {
+					t.Errorf("expected an image decode error for node(logo) > node[0], got %v", err)
+				}
+			},
+		},
+		{
+			name: "top level node that can't be drawn",
+			nodes: func(t *testing.T) []*LayoutNode {
+				node := &LayoutNode{ID: "logo", VisualNode: ImageNode{Src: brokenImage(t)}, Width: StaticSize(10), Height: StaticSize(10)}
+				node.bindFutures()
+				return []*LayoutNode{node}
+			},
+			check: func(t *testing.T, err error) {
+				var decode *ImageDecodeError
+				if !errors.As(err, &decode) || decode.Path.String() != "node(logo)" {
+					t.Errorf("expected an image decode error for node(logo), got %v", err)
+				}
+			},
+		},
+		{
+			name: "output that can't be written",
+			nodes: func(t *testing.T) []*LayoutNode {
+				return []*LayoutNode{box(10, LayoutNodeProps{})}
+			},
+			writer: failingWriter{},
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, errWriteFailed) {
+					t.Errorf("expected the write error, got %v", err)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			builder := newTestBuilder(t)
+			err := builder.CreateDocumentTree(test.nodes(t))
+			if test.layout {
+				if err == nil {
+					t.Fatal("expected the layout to fail")
+				}
+				test.check(t, err)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			writer := test.writer
+			if writer == nil {
+				writer = io.Discard
+			}
+
+			err = builder.RenderToWriter(writer)
+			if err == nil {
+				t.Fatal("expected rendering to fail")
+			}
+			test.check(t, err)
+		})
+	}
+}
+
+func TestRenderToWriter(t *testing.T) {
+	builder := newTestBuilder(t)
+	err := builder.CreateDocumentTree([]*LayoutNode{
+		Text(nil, LayoutNodeProps{Width: WidthFill(), Height: StaticSize(10)}, TextNode{Text: "Hello, World!"}),
+		Image(nil, LayoutNodeProps{Width: StaticSize(50), Height: StaticSize(50)}, ImageNode{Src: "./example/example_image.jpg"}),
+		RichText(nil, LayoutNodeProps{Width: WidthFill(), Height: HeightAsChildren()}, RichTextNode{Spans: []TextSpan{
+			{Text: "Hello, ", FontFamily: "Inter", FontSize: 12},
+			{Text: "World!", FontFamily: "Inter", FontStyle: FontBold, FontSize: 16, Underline: true},
+		}}),
+		RichText(nil, LayoutNodeProps{Width: WidthFill(), Height: HeightAsChildren()}, RichTextNode{FontSize: 12}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "document.pdf")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	err = builder.RenderToWriter(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() == 0 {
+		t.Error("expected the PDF to be written")
+	}
+}
+
+// spanTexts returns the text of the spans on each line
+func spanTexts(lines [][]TextSpan) [][]string {
+	result := make([][]string, len(lines))
+	for idx, line := range lines {
+		result[idx] = make([]string, 0)
+		for _, span := range line {
+			result[idx] = append(result[idx], span.Text)
+		}
+	}
+	return result
+}
+
+func TestSplitRichText(t *testing.T) {
+	renderer := newTestRenderer(t)
+
+	tests := []struct {
+		name     string
+		rect     Rect
+		spans    []TextSpan
+		expected [][]string
+	}{
+		{
+			name:     "empty paragraph has one line",
+			rect:     Rect{100, 100},
+			spans:    nil,
+			expected: [][]string{{}},
+		},
+		{
+			name: "spans that fit share a line",
+			rect: Rect{100, 100},
+			spans: []TextSpan{
+				{Text: "Hello, ", FontFamily: "Inter", FontSize: 10},
+				{Text: "World", FontFamily: "Inter", FontStyle: FontBold, FontSize: 10},
+			},
+			expected: [][]string{{"Hello, ", "World"}},
+		},
+		{
+			name: "spans are broken at the line breaks in their text",
+			rect: Rect{100, 100},
+			spans: []TextSpan{
+				{Text: "one two\nthree ", FontFamily: "Inter", FontSize: 10},
+				{Text: "four", FontFamily: "Inter", FontStyle: FontItalic, FontSize: 10},
+			},
+			expected: [][]string{{"one two\n"}, {"three ", "four"}},
+		},
+		{
+			name: "paragraph wraps across spans",
+			rect: Rect{22, 100},
+			spans: []TextSpan{
+				{Text: "The quick brown ", FontFamily: "Inter", FontSize: 10},
+				{Text: "fox jumps", FontFamily: "Inter", FontStyle: FontBold, FontSize: 10},
+			},
+			expected: [][]string{{"The quick "}, {"brown ", "fox "}, {"jumps"}},
+		},
+		{
+			name: "lines that don't fit are cut off",
+			rect: Rect{100, 5},
+			spans: []TextSpan{
+				{Text: "first\nsecond", FontFamily: "Inter", FontSize: 10},
+			},
+			expected: [][]string{{"first\n"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines := spanTexts(renderer.SplitRichText(test.rect, RichTextNode{Spans: test.spans}))
+			if !reflect.DeepEqual(lines, test.expected) {
+				t.Errorf("expected %q, got %q", test.expected, lines)
+			}
+		})
+	}
+}
+
+func TestTextLineOffset(t *testing.T) {
+	tests := []struct {
+		name      string
+		alignment textAlignment
+		width     Size
+		expected  Size
+	}{
+		{"left", TextLeft, 40, 0},
+		{"center", TextCenter, 40, 30},
+		{"right", TextRight, 40, 60},
+		{"justified lines start at the left edge", TextJustify, 40, 0},
+		{"centered line wider than the available width", TextCenter, 120, 0},
+		{"right aligned line wider than the available width", TextRight, 120, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if offset := textLineOffset(test.alignment, 100, test.width); !sizesEqual(offset, test.expected) {
+				t.Errorf("expected an offset of %f, got %f", test.expected, offset)
+			}
+		})
+	}
+}
+
+func TestJustifiedWordSpacing(t *testing.T) {
+	tests := []struct {
+		name     string
+		width    Size
+		spaces   int
+		expected Size
+	}{
+		{"free space is shared between the spaces", 70, 3, 10},
+		{"line without spaces isn't stretched", 70, 0, 0},
+		{"line as wide as the available width", 100, 3, 0},
+		{"line wider than the available width", 120, 3, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if spacing := justifiedWordSpacing(100, test.width, test.spaces); !sizesEqual(spacing, test.expected) {
+				t.Errorf("expected a word spacing of %f, got %f", test.expected, spacing)
+			}
+		})
+	}
+}
+
+// justifiedLines renders the node, and reports whether any of its lines were
+// stretched by word spacing
+func justifiedLines(t *testing.T, node *LayoutNode) bool {
+	t.Helper()
+
+	renderer := newTestRenderer(t)
+	renderer.pdf.SetCompression(false)
+	builder := NewDocumentBuilder(renderer, DocumentSizeLetter, testPageMargin)
+	err := builder.CreateDocumentTree([]*LayoutNode{node})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var output bytes.Buffer
+	err = builder.RenderToWriter(&output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, match := range regexp.MustCompile(`([0-9.]+) Tw`).FindAllStringSubmatch(output.String(), -1) {
+		if spacing, _ := strconv.ParseFloat(match[1], 64); spacing != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func TestJustifiedLastLine(t *testing.T) {
+	const paragraph = "The quick brown fox jumps over the lazy dog and keeps on running"
+	props := LayoutNodeProps{Width: StaticSize(60), Height: StaticSize(20)}
+	span := TextSpan{Text: paragraph, FontFamily: "Inter", FontSize: 12}
+
+	tests := []struct {
+		name     string
+		node     func() *LayoutNode
+		expected bool
+	}{
+		{
+			name: "wrapped lines are stretched",
+			node: func() *LayoutNode {
+				return Text(nil, props, TextNode{Text: paragraph, Alignment: TextJustify})
+			},
+			expected: true,
+		},
+		{
+			name: "truncated line is the last line",
+			node: func() *LayoutNode {
+				return Text(nil, props, TextNode{Text: paragraph, Alignment: TextJustify, OverflowBehavior: overflowTruncate})
+			},
+			expected: false,
+		},
+		{
+			name: "wrapped rich text lines are stretched",
+			node: func() *LayoutNode {
+				return RichText(nil, props, RichTextNode{Spans: []TextSpan{span}, Alignment: TextJustify})
+			},
+			expected: true,
+		},
+		{
+			name: "truncated rich text line is the last line",
+			node: func() *LayoutNode {
+				return RichText(nil, props, RichTextNode{Spans: []TextSpan{span}, Alignment: TextJustify, OverflowBehavior: overflowTruncate})
+			},
+			expected: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if justified := justifiedLines(t, test.node()); justified != test.expected {
+				t.Errorf("expected justified lines to be %t, got %t", test.expected, justified)
+			}
+		})
+	}
+}
+
+func TestTextBlockOffset(t *testing.T) {
+	tests := []struct {
+		name        string
+		alignment   textVerticalAlignment
+		blockHeight Size
+		expected    Size
+	}{
+		{"top", TextTop, 40, 0},
+		{"middle", TextMiddle, 40, 30},
+		{"bottom", TextBottom, 40, 60},
+		{"baseline of the last line on the bottom edge", TextBaseline, 40, 65},
+		{"block taller than the available height is cut off at the bottom", TextBottom, 120, 0},
+		{"middle of a block taller than the available height", TextMiddle, 120, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// the baseline of the last line is 5mm above the bottom of the
+			// block
+			offset := textBlockOffset(test.alignment, 100, test.blockHeight, test.blockHeight-5)
+			if !sizesEqual(offset, test.expected) {
+				t.Errorf("expected an offset of %f, got %f", test.expected, offset)
+			}
+		})
+	}
+}
+
+func TestSplitText(t *testing.T) {
+	renderer := newTestRenderer(t)
+
+	tests := []struct {
+		name     string
+		rect     Rect
+		text     string
+		expected []string
+	}{
+		{"empty text has one line", Rect{100, 100}, "", []string{""}},
+		{"text that fits", Rect{100, 100}, "Hello, World!", []string{"Hello, World!"}},
+		{"hard line breaks", Rect{100, 100}, "Hello,\nWorld!", []string{"Hello,\n", "World!"}},
+		{"wrapped after the spaces", Rect{22, 100}, "The quick brown fox jumps", []string{"The quick ", "brown fox ", "jumps"}},
+		{"lines that don't fit are cut off", Rect{22, 8}, "The quick brown fox jumps", []string{"The quick ", "brown fox "}},
+		{"first line is kept even if it doesn't fit", Rect{22, 1}, "The quick brown fox jumps", []string{"The quick "}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines := renderer.SplitText(test.rect, TextNode{Text: test.text, FontFamily: "Inter", FontSize: 10})
+			if !reflect.DeepEqual(lines, test.expected) {
+				t.Errorf("expected %q, got %q", test.expected, lines)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package docspec
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 )
 
 /* Functions for walking the document tree and resolving x, y, width & height values */
@@ -13,10 +15,10 @@ type resolverCursor struct {
 
 // recursively sets the positions for child trees inside a node.  Note that in
 // this ideal little world we can just walk the tree and increment a cursor
-// without worrying about page breaks, since we only allow page breaks over top
-// level elements.  This function assumes that the cursor is currently
-// positioned at the top left corner of the parent node's (the node argument's)
-// render rect
+// without worrying about page breaks, since by the time a node is positioned
+// it has already been split into fragments that each fit on a page.  This
+// function assumes that the cursor is currently positioned at the top left
+// corner of the parent node's (the node argument's) render rect
 func recursiveSetPositions(node *LayoutNode, cursor *resolverCursor) error {
 
 	// if the node has no children, this function has nothing to do
@@ -27,35 +29,27 @@ func recursiveSetPositions(node *LayoutNode, cursor *resolverCursor) error {
 	startingX := cursor.x
 	startingY := cursor.y
 
-	firstChildNode := node.Children[0]
 	parentDrawRect, err := node.getDrawRect()
-
-	if err != nil {
-		return err
-	}
-
-	// for every possible permutation of flowDirection and childAlignment, find
-	// the starting X and Y position of the first child.  Once this is found,
-	// we can simply iterate along the other children, and use width and height
-	// to increment the cursor.
-	childBoundingRect, err := firstChildNode.getBoundingRect()
 	if err != nil {
 		return err
 	}
 
-	// measure the full column/row width and height for below calculations
-	fullChildrenWidth := 0.0
-	fullChildrenHeight := 0.0
+	// measure the bounding rect of every child.  Children are laid out one
+	// after the other along the "main" axis (the direction in which they
+	// flow), and aligned individually along the "cross" axis.  Children that
+	// are out of the normal flow are positioned separately below.
+	children := node.flowChildren()
+	widths := make([]Size, len(children))
+	heights := make([]Size, len(children))
 
-	for _, child := range node.Children {
+	for idx, child := range children {
 		cbr, err := child.getBoundingRect()
-
 		if err != nil {
 			return err
 		}
 
-		fullChildrenHeight += cbr.height
-		fullChildrenWidth += cbr.width
+		widths[idx] = cbr.width
+		heights[idx] = cbr.height
 	}
 
 	// move the cursor to the "start" position of the parent's draw rect -- the
@@ -64,159 +58,71 @@ func recursiveSetPositions(node *LayoutNode, cursor *resolverCursor) error {
 	cursor.x += node.Padding.left
 	cursor.y += node.Padding.top
 
-	if node.ChildFlowDirection == FlowVertical {
-		// the column of children will only be one child across
-		switch node.ChildAlignment.Horizontal {
-		case Start:
-			// we're starting at the top left corner and going down, so we
-			// don't have any measurement to do, besides taking into account
-			// the child's margin.  We don't have to take this into account in
-			// the other cases because we use the child's bounding rect, which
-			// already takes into account margin.
-			cursor.x += firstChildNode.Margin.left
-			break
-		case End:
-			// we're starting at the right edge and going down, so to get
-			// the x we need to move the column of children as far over the
-			// parent's draw rect will allow
-			delta := (parentDrawRect.width - childBoundingRect.width)
-			if delta > 0 {
-				cursor.x += delta
-			}
-			break
-		case Center:
-			// we're starting at the top, but the middle of the child node has
-			// to be equidistant from both sides of the parent draw rect
-			childWidth := childBoundingRect.width
-			midParentWidth := parentDrawRect.width / 2
-			distanceToMove := (midParentWidth - (childWidth / 2))
-			cursor.x += distanceToMove
-			break
-		}
+	var xOffsets, yOffsets []Size
 
-		switch node.ChildAlignment.Vertical {
-		case Start:
-			// see "Start" documentation for horizontal above
-			cursor.y += firstChildNode.Margin.top
-			break
-		case End:
-			// we're starting at the bottom edge, so to get the y we need to
-			// move the column of children as far down as we can.  This
-			// requires measuing the height of the column.
-			diff := parentDrawRect.height - fullChildrenHeight
-			if diff > 0 {
-				cursor.y += diff
-			}
-			break
-		case Center:
-			// the middle of the column of children must be equidistant from
-			// the top and bottom of the parent's draw rect
-			diff := (parentDrawRect.height - fullChildrenHeight) / 2
-			cursor.y += diff
-			break
+	switch {
+	case node.grid != nil:
+		// each child is positioned within its own area of the grid
+		xOffsets, yOffsets, err = gridOffsets(node, children, widths, heights)
+		if err != nil {
+			return err
 		}
-	} else if node.ChildFlowDirection == FlowHorizontal {
-		// see comments above for thoughts.  Basically we're just inverting
-		// everything.
-		switch node.ChildAlignment.Horizontal {
-		case Start:
-			cursor.x += firstChildNode.Margin.left
-			break
-		case End:
-			diff := parentDrawRect.width - fullChildrenWidth
-			if diff > 0 {
-				cursor.x += diff
+	case node.ChildFlowDirection == FlowVertical:
+		// the column of children will only be one child across
+		yOffsets = mainAxisOffsets(node.ChildAlignment.Vertical, parentDrawRect.height, heights, node.RowGap)
+		xOffsets = crossAxisOffsets(node.ChildAlignment.Horizontal, parentDrawRect.width, widths, children)
+	case node.ChildFlowDirection == FlowHorizontal:
+		if node.ChildWrap {
+			xOffsets, yOffsets, err = wrappedOffsets(node, parentDrawRect, widths, heights)
+			if err != nil {
+				return err
 			}
 			break
-		case Center:
-			diff := (parentDrawRect.width - fullChildrenWidth) / 2
-			cursor.x += diff
-			break
 		}
 
-		switch node.ChildAlignment.Vertical {
-		case Start:
-			cursor.y += firstChildNode.Margin.top
-			break
-		case End:
-			childHeight := childBoundingRect.height
-			diff := parentDrawRect.height - childHeight
-			if diff > 0 {
-				cursor.y += diff
-			}
-			break
-		case Center:
-			diff := parentDrawRect.height - childBoundingRect.height
-			distanceToMove := diff / 2
-			cursor.y += distanceToMove
-			break
-		}
-	} else {
+		// see above for thoughts.  Basically we're just inverting everything.
+		xOffsets = mainAxisOffsets(node.ChildAlignment.Horizontal, parentDrawRect.width, widths, node.ColumnGap)
+		yOffsets = crossAxisOffsets(node.ChildAlignment.Vertical, parentDrawRect.height, heights, children)
+	default:
 		return fmt.Errorf("unhandled childFlowDirection '%+v' in resolver", node.ChildFlowDirection)
 	}
 
-	for idx, child := range node.Children {
-		child.X = cursor.x
-		child.Y = cursor.y
+	originX := cursor.x
+	originY := cursor.y
+
+	for idx, child := range children {
+		// the offsets are of the child's bounding rect, so we need to take
+		// into account the child's margin to get to its render rect
+		child.X = originX + xOffsets[idx] + child.Margin.left
+		child.Y = originY + yOffsets[idx] + child.Margin.top
+
+		if child.Position == PositionRelative {
+			child.X += child.OffsetX
+			child.Y += child.OffsetY
+		}
+
+		cursor.x = child.X
+		cursor.y = child.Y
 
 		err := recursiveSetPositions(child, cursor)
 		if err != nil {
 			return err
 		}
+	}
 
-		// now that we have set the x and y positions for the child and all of
-		// its children, we need to move the cursor into the correct position
-		// for the next sibling.
-
-		childBoundingRect, err = child.getBoundingRect()
+	for _, child := range node.Children {
+		if !child.isOutOfFlow() {
+			continue
+		}
 
-		// difference in width between this node and the next node in the list
-		var diffW Size
-		// difference in height between this node and the next node in the list
-		var diffH Size
+		positionOutOfFlow(child, resolverCursor{startingX, startingY})
 
-		if idx != len(node.Children)-1 {
-			// there is a nextnode
-			nextNode := node.Children[idx+1]
-			nextBoundingRect, err := nextNode.getBoundingRect()
-			if err != nil {
-				return err
-			}
+		cursor.x = child.X
+		cursor.y = child.Y
 
-			diffW = childBoundingRect.width - nextBoundingRect.width
-			diffH = childBoundingRect.height - nextBoundingRect.height
-
-			switch node.ChildFlowDirection {
-			case FlowHorizontal:
-				cursor.x += childBoundingRect.width + nextNode.Margin.left
-				// depending on the child alignment along the oppositive axis,
-				// we may need to adjust the opposite axis to account for
-				// differently sized sibling nodes
-				switch node.ChildAlignment.Vertical {
-				case Start:
-					break
-				case End:
-					cursor.y += diffH
-					break
-				case Center:
-					cursor.y += diffH / 2
-					break
-				}
-				break
-			case FlowVertical:
-				cursor.y += childBoundingRect.height + nextNode.Margin.top
-				switch node.ChildAlignment.Horizontal {
-				case Start:
-					break
-				case End:
-					cursor.x += diffW
-					break
-				case Center:
-					cursor.x += diffW / 2
-					break
-				}
-				break
-			}
+		err := recursiveSetPositions(child, cursor)
+		if err != nil {
+			return err
 		}
 	}
 
@@ -235,66 +141,402 @@ func recursiveSetPositions(node *LayoutNode, cursor *resolverCursor) error {
 	return nil
 }
 
+// positionOutOfFlow positions a node that is out of the normal flow at its
+// offsets from the top left corner of its container, or of the page if it is
+// positioned in terms of the page.
+func positionOutOfFlow(node *LayoutNode, container resolverCursor) {
+	if node.Position == PositionPage {
+		container = resolverCursor{}
+	}
+
+	node.X = container.x + node.OffsetX + node.Margin.left
+	node.Y = container.y + node.OffsetY + node.Margin.top
+}
+
+// wrappedOffsets calculates the offsets of the children of a node whose
+// children wrap onto multiple lines.  Each line is laid out like a row of its
+// own, and the lines are then stacked from top to bottom, using the vertical
+// child alignment both to align the lines within the parent and to align the
+// children within each line.
+func wrappedOffsets(node *LayoutNode, parentDrawRect Rect, widths []Size, heights []Size) ([]Size, []Size, error) {
+	lines, err := node.wrapLines()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lineHeights := make([]Size, len(lines))
+	for idx, line := range lines {
+		tallest, err := tallestBoundingHeight(line)
+		if err != nil {
+			return nil, nil, err
+		}
+		lineHeights[idx] = tallest
+	}
+
+	lineOffsets := mainAxisOffsets(node.ChildAlignment.Vertical, parentDrawRect.height, lineHeights, node.RowGap)
+
+	xOffsets := make([]Size, 0, len(widths))
+	yOffsets := make([]Size, 0, len(heights))
+
+	// the lines contain the children in order, so we can walk the measured
+	// sizes alongside them
+	first := 0
+	for idx, line := range lines {
+		last := first + len(line)
+
+		xOffsets = append(xOffsets, mainAxisOffsets(node.ChildAlignment.Horizontal, parentDrawRect.width, widths[first:last], node.ColumnGap)...)
+		for _, offset := range crossAxisOffsets(node.ChildAlignment.Vertical, lineHeights[idx], heights[first:last], line) {
+			yOffsets = append(yOffsets, lineOffsets[idx]+offset)
+		}
+
+		first = last
+	}
+
+	return xOffsets, yOffsets, nil
+}
+
+// mainAxisOffsets calculates the offset of each child's bounding rect from the
+// start of the parent's draw rect, along the axis in which the children flow.
+// The distribution modes fall back to `Start` if the children overflow the
+// parent, since there is no space to distribute.  The gap is added between
+// each pair of children, on top of any space from the distribution mode.
+func mainAxisOffsets(alignment childAlignment, available Size, sizes []Size, gap Size) []Size {
+	total := totalGap(gap, len(sizes))
+	for _, size := range sizes {
+		total += size
+	}
+
+	free := available - total
+	count := float64(len(sizes))
+
+	// the position of the first child, and the space between each child
+	start := emptySize
+	spacing := emptySize
+
+	switch alignment {
+	case Start:
+		break
+	case End:
+		// move the children as far over as the parent's draw rect will allow
+		if free > 0 {
+			start = free
+		}
+	case Center:
+		// the middle of the children must be equidistant from both sides of
+		// the parent's draw rect
+		start = free / 2
+	case SpaceBetween:
+		// the first and last child touch the edges, and the rest of the space
+		// goes between the children
+		if free > 0 && len(sizes) > 1 {
+			spacing = free / (count - 1)
+		}
+	case SpaceAround:
+		// every child gets the same space on either side of it, so the space
+		// at the edges is half the space between children
+		if free > 0 {
+			spacing = free / count
+			start = spacing / 2
+		}
+	case SpaceEvenly:
+		// the space at the edges is the same as the space between children
+		if free > 0 {
+			spacing = free / (count + 1)
+			start = spacing
+		}
+	}
+
+	offsets := make([]Size, len(sizes))
+	position := start
+	for idx, size := range sizes {
+		offsets[idx] = position
+		position += size + spacing + gap
+	}
+
+	return offsets
+}
+
+// crossAxisOffsets calculates the offset of each child's bounding rect from
+// the start of the parent's draw rect, along the axis perpendicular to the
+// one in which the children flow.  Each child is aligned by itself, either by
+// the parent's alignment or by the child's own `AlignSelf`.
+func crossAxisOffsets(alignment childAlignment, available Size, sizes []Size, children []*LayoutNode) []Size {
+	offsets := make([]Size, len(sizes))
+
+	for idx, size := range sizes {
+		offsets[idx] = crossAxisOffset(children[idx].crossAlignment(alignment), available, size)
+	}
+
+	return offsets
+}
+
+// crossAxisOffset calculates the offset of a single bounding rect within the
+// available space.  The distribution modes have no meaning for a single child
+// and behave like `Start`.
+func crossAxisOffset(alignment childAlignment, available Size, size Size) Size {
+	diff := available - size
+
+	switch alignment {
+	case End:
+		if diff > 0 {
+			return diff
+		}
+	case Center:
+		return diff / 2
+	}
+
+	return emptySize
+}
+
 // resolveNodeRectPositions iterates over the nodes in the document builder's
-// node list with a cursor and resolve the X and Y positions
+// node list with a cursor and resolve the X and Y positions, splitting nodes
+// over as many pages as are required to fit them.  Every section in the node
+// list starts a new page with the section's page geometry, and the nodes
+// after a section start a new page with the document's own page geometry.
 func resolveNodeRectPositions(d *DocumentBuilder) error {
 	document := d.document
-
 	currentPage := document.Children[0]
-	cursor := resolverCursor{
-		x: currentPage.Margin.left,
-		y: currentPage.Margin.top,
-	}
 
-	// FIXME: the only issue I can think of here is that d.nodes is somehow
-	// being modified as we go through the nodelist
-	for idx, node := range d.nodes {
-		node.X = cursor.x + node.Margin.left
-		node.Y = cursor.y + node.Margin.top
-		currentPage.addNode(node)
+	// top-level nodes are collected into runs, which are paginated together:
+	// either the children of a section, or the nodes between sections
+	run := make([]*LayoutNode, 0)
+	inSection := false
 
-		nextCursor := cursor
-		// prepare nextCursor position so that it's at the top left corner of
-		// the parent node's RENDER rect, not the bounding rect
-		nextCursor.x += node.Margin.left
-		nextCursor.y += node.Margin.top
-		err := recursiveSetPositions(node, &nextCursor)
+	for _, node := range d.nodes {
+		if node.section == nil && !inSection {
+			run = append(run, node)
+			continue
+		}
 
+		page, err := paginateNodes(document, currentPage, run)
 		if err != nil {
 			return err
 		}
 
-		nodeBoundingRect, err := node.getBoundingRect()
-		nodeHeight := nodeBoundingRect.height
+		if node.section == nil {
+			currentPage = document.startSection(page, document.geometry)
+			run = []*LayoutNode{node}
+			inSection = false
+			continue
+		}
 
+		currentPage = document.startSection(page, *node.section)
+		run = append(make([]*LayoutNode, 0), node.Children...)
+		inSection = true
+	}
+
+	_, err := paginateNodes(document, currentPage, run)
+	return err
+}
+
+// paginateNodes places a list of top level nodes starting at the top of the
+// given page, adding new pages as required, and returns the last page.
+func paginateNodes(document *Document, currentPage *Page, nodes []*LayoutNode) (*Page, error) {
+	remaining := nodes
+
+	for len(remaining) > 0 {
+		// top level nodes are measured relative to the page that they are
+		// about to be placed on, so any sizes that were resolved while
+		// trying to fit them onto the previous page no longer apply
+		for _, node := range remaining {
+			if node.Page != currentPage {
+				node.invalidateSizes()
+				node.Page = currentPage
+			}
+		}
+
+		// each node is measured against the space that is left on the page
+		// once the nodes before it have been placed
+		currentPage.pending = remaining
+
+		available := currentPage.getDrawRect().height
+		head, tail, _, err := splitChildren(remaining, available, emptySize, false)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		if nodeHeight > currentPage.Height {
-			return fmt.Errorf("top level element had calculated height of %f, which is larger than page height of %f", nodeHeight, currentPage.Height)
+		if len(head) == 0 {
+			// the page is empty, so keeping content together is no longer an
+			// option -- the only alternative would be to never place it
+			head, tail, _, err = splitChildren(remaining, available, emptySize, true)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if len(head) == 0 {
+			// nothing fits on an empty page, so nothing ever will
+			nodeHeight, err := remaining[0].getBoundingHeight()
+			if err != nil {
+				return nil, err
+			}
+			return nil, &OverflowError{Path: pathOf(remaining[0]), Property: "Height", Size: nodeHeight, Available: available}
+		}
+
+		cursor := resolverCursor{
+			x: currentPage.Margin.left,
+			y: currentPage.Margin.top,
+		}
+
+		currentPage.pending = nil
+		for _, node := range head {
+			err := placeTopLevelNode(currentPage, node, &cursor)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		remaining = tail
+		if len(remaining) > 0 {
+			currentPage = document.addPage()
 		}
+	}
+
+	return currentPage, nil
+}
+
+// placeTopLevelNode adds the node to the page at the cursor, resolves the
+// positions of the node's tree, and moves the cursor past the node.
+func placeTopLevelNode(page *Page, node *LayoutNode, cursor *resolverCursor) error {
+	node.X = cursor.x + node.Margin.left
+	node.Y = cursor.y + node.Margin.top
+
+	switch {
+	case node.isOutOfFlow():
+		positionOutOfFlow(node, resolverCursor{page.Margin.left, page.Margin.top})
+	case node.Position == PositionRelative:
+		node.X += node.OffsetX
+		node.Y += node.OffsetY
+	}
+
+	page.addNode(node)
+
+	// prepare nextCursor position so that it's at the top left corner of
+	// the node's RENDER rect, not the bounding rect
+	nextCursor := resolverCursor{node.X, node.Y}
+	err := recursiveSetPositions(node, &nextCursor)
+	if err != nil {
+		return err
+	}
 
-		// note that we are purposely not changing the X cursor at the top level.
-		// The top level gets special treatment -- see recursiveSetPositions for
-		// the "real" implementaiton
-		cursor.y += nodeHeight
+	if node.isOutOfFlow() {
+		// the node doesn't take up any space on the page
+		return nil
+	}
 
-		if idx != len(d.nodes)-1 {
-			// if we are not on the last node, get the height of the NEXT node,
-			// and figure out if we need to split pages.
-			nextHeight, err := d.nodes[idx+1].Height.await()
+	nodeHeight, err := node.getBoundingHeight()
+	if err != nil {
+		return err
+	}
+
+	// note that we are purposely not changing the X cursor at the top level.
+	// The top level gets special treatment -- see recursiveSetPositions for
+	// the "real" implementaiton
+	cursor.y += nodeHeight
+
+	return nil
+}
+
+const (
+	// PageNumberPlaceholder is replaced by the number of the current page in
+	// the text of headers and footers
+	PageNumberPlaceholder = "{page}"
+	// PageCountPlaceholder is replaced by the total number of pages in the
+	// text of headers and footers
+	PageCountPlaceholder = "{pages}"
+)
+
+// resolvePageDecorations creates a copy of the document builder's header and
+// footer for each page of the document, and resolves the X and Y positions
+// inside of the page margins.
+func resolvePageDecorations(d *DocumentBuilder) error {
+	pageCount := len(d.document.Children)
+
+	for idx, page := range d.document.Children {
+		replacer := strings.NewReplacer(
+			PageNumberPlaceholder, strconv.Itoa(idx+1),
+			PageCountPlaceholder, strconv.Itoa(pageCount),
+		)
+
+		if d.header != nil {
+			header, err := newPageDecoration(d, page, "header", d.header, 0.0, page.Margin.top, replacer)
 			if err != nil {
 				return err
 			}
+			page.Header = header
+		}
 
-			if cursor.y+nextHeight > (currentPage.getDrawRect().height - currentPage.Margin.bottom) {
-				currentPage = d.document.addPage()
-				cursor.x = currentPage.Margin.left
-				cursor.y = currentPage.Margin.top
+		if d.footer != nil {
+			footer, err := newPageDecoration(d, page, "footer", d.footer, page.Height-page.Margin.bottom, page.Margin.bottom, replacer)
+			if err != nil {
+				return err
 			}
+			page.Footer = footer
 		}
 	}
 
 	return nil
 }
+
+// newPageDecoration copies the given tree into a node covering the width of
+// the page's draw rect, starting at y and extending for the given height.  The
+// node is named after the decoration, so that errors point at it.
+func newPageDecoration(d *DocumentBuilder, page *Page, name string, tree *LayoutNode, y Size, height Size, replacer *strings.Replacer) (*LayoutNode, error) {
+	container := &LayoutNode{
+		ID:       name,
+		Page:     page,
+		Children: make([]*LayoutNode, 0),
+		X:        page.Margin.left,
+		Y:        y,
+		Width:    StaticSize(page.getDrawRect().width),
+		Height:   StaticSize(height),
+	}
+	container.bindFutures()
+
+	content := tree.Clone()
+	replaceTextPlaceholders(content, replacer)
+	container.adoptChild(content)
+	setDocumentRendererContext(container, d.renderer)
+
+	// the decoration lives in the page's margin, and would draw over the
+	// body of the page if it didn't fit into it
+	contentHeight, err := content.getBoundingHeight()
+	if err != nil {
+		return nil, err
+	}
+	if contentHeight > height+layoutEpsilon {
+		return nil, &OverflowError{Path: pathOf(content), Property: "Height", Size: contentHeight, Available: height}
+	}
+
+	cursor := resolverCursor{container.X, container.Y}
+	err = recursiveSetPositions(container, &cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	return container, nil
+}
+
+// replaceTextPlaceholders walks the tree and substitutes placeholders in the
+// text of every text node
+func replaceTextPlaceholders(node *LayoutNode, replacer *strings.Replacer) {
+	if textNode, ok := node.VisualNode.(TextNode); ok {
+		textNode.Text = replacer.Replace(textNode.Text)
+		node.VisualNode = textNode
+	}
+
+	if richTextNode, ok := node.VisualNode.(RichTextNode); ok {
+		// the spans are shared with the node that this one was cloned from
+		spans := make([]TextSpan, len(richTextNode.Spans))
+		for idx, span := range richTextNode.Spans {
+			span.Text = replacer.Replace(span.Text)
+			spans[idx] = span
+		}
+		richTextNode.Spans = spans
+		node.VisualNode = richTextNode
+	}
+
+	for _, child := range node.Children {
+		replaceTextPlaceholders(child, replacer)
+	}
+}
@@ -0,0 +1,712 @@
+package docspec
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testPage is the geometry of a page of a document
+type testPage struct {
+	width, height Size
+	margin        SizesQuad
+	nodes         int
+}
+
+func TestSections(t *testing.T) {
+	a4Landscape := DocumentSizeA4.Landscape()
+	letterMargin := NewSingletonSizeQuad(testPageMargin)
+	sectionMargin := NewSingletonSizeQuad(20)
+
+	tests := []struct {
+		name     string
+		nodes    func() []*LayoutNode
+		expected []testPage
+	}{
+		{
+			name: "section starts a new page with its own geometry",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{
+					box(50, LayoutNodeProps{}),
+					Section(SectionProps{Size: &a4Landscape, Margin: &sectionMargin}, func(section *LayoutNode) {
+						cell(section, 50, LayoutNodeProps{})
+					}),
+				}
+			},
+			expected: []testPage{
+				{215.9, 279.4, letterMargin, 1},
+				{297, 210, NewSingletonSizeQuad(20), 1},
+			},
+		},
+		{
+			name: "section at the start of the document reuses the first page",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{
+					Section(SectionProps{Size: &a4Landscape, Margin: &sectionMargin}, func(section *LayoutNode) {
+						cell(section, 50, LayoutNodeProps{})
+					}),
+				}
+			},
+			expected: []testPage{{297, 210, NewSingletonSizeQuad(20), 1}},
+		},
+		{
+			name: "size and margin left unset are taken from the previous page",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{
+					box(50, LayoutNodeProps{}),
+					Section(SectionProps{}, func(section *LayoutNode) {
+						cell(section, 50, LayoutNodeProps{})
+					}),
+				}
+			},
+			expected: []testPage{
+				{215.9, 279.4, letterMargin, 1},
+				{215.9, 279.4, letterMargin, 1},
+			},
+		},
+		{
+			name: "section without margins",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{
+					box(50, LayoutNodeProps{}),
+					Section(SectionProps{Margin: &SizesQuad{}}, func(section *LayoutNode) {
+						cell(section, 50, LayoutNodeProps{})
+					}),
+				}
+			},
+			expected: []testPage{
+				{215.9, 279.4, letterMargin, 1},
+				{215.9, 279.4, SizesQuad{}, 1},
+			},
+		},
+		{
+			name: "nodes after a section go back to the document's geometry",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{
+					Section(SectionProps{Size: &a4Landscape, Margin: &sectionMargin}, func(section *LayoutNode) {
+						cell(section, 50, LayoutNodeProps{})
+						cell(section, 50, LayoutNodeProps{})
+					}),
+					box(50, LayoutNodeProps{}),
+					box(50, LayoutNodeProps{}),
+				}
+			},
+			expected: []testPage{
+				{297, 210, NewSingletonSizeQuad(20), 2},
+				{215.9, 279.4, letterMargin, 2},
+			},
+		},
+		{
+			name: "section content continues on pages of the section's size",
+			nodes: func() []*LayoutNode {
+				return []*LayoutNode{
+					Section(SectionProps{Size: &a4Landscape, Margin: &sectionMargin}, func(section *LayoutNode) {
+						cell(section, 100, LayoutNodeProps{})
+						cell(section, 100, LayoutNodeProps{})
+					}),
+				}
+			},
+			expected: []testPage{
+				{297, 210, NewSingletonSizeQuad(20), 1},
+				{297, 210, NewSingletonSizeQuad(20), 1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			document := layoutNodes(t, test.nodes()...)
+			if len(document.Children) != len(test.expected) {
+				t.Fatalf("expected %d pages, got %d", len(test.expected), len(document.Children))
+			}
+
+			for idx, expected := range test.expected {
+				page := document.Children[idx]
+				actual := testPage{page.Width, page.Height, page.Margin, len(page.Children)}
+				if actual != expected {
+					t.Errorf("page %d: expected %+v, got %+v", idx+1, expected, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestPageDecorationsInSectionWithoutMargin(t *testing.T) {
+	a4 := DocumentSizeA4
+	builder := newTestBuilder(t)
+	builder.SetFooter(Text(nil, LayoutNodeProps{Width: WidthFill(), Height: HeightFill()}, TextNode{Text: "Page {page} of {pages}", FontSize: 8}))
+
+	err := builder.CreateDocumentTree([]*LayoutNode{
+		box(50, LayoutNodeProps{}),
+		Section(SectionProps{Size: &a4}, func(section *LayoutNode) {
+			cell(section, 50, LayoutNodeProps{})
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for idx, page := range builder.document.Children {
+		footer := rectOf(t, page.Footer.Children[0])
+		expected := testRect{testPageMargin, page.Height - testPageMargin, page.Width - 2*testPageMargin, testPageMargin}
+		if !footer.equals(expected) {
+			t.Errorf("page %d: expected footer at %+v, got %+v", idx+1, expected, footer)
+		}
+
+		text, _ := textLeaf(page.Footer.Children[0])
+		if want := []string{"Page 1 of 2", "Page 2 of 2"}[idx]; text.Text != want {
+			t.Errorf("page %d: expected footer text %q, got %q", idx+1, want, text.Text)
+		}
+	}
+}
+
+// decorationText returns the text of the first text node in a page's header
+// or footer
+func decorationText(node *LayoutNode) string {
+	switch visualNode := node.VisualNode.(type) {
+	case TextNode:
+		return visualNode.Text
+	case RichTextNode:
+		return spansText(visualNode.Spans)
+	}
+
+	for _, child := range node.Children {
+		if text := decorationText(child); text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+func TestPageDecorations(t *testing.T) {
+	const width = 195.9
+
+	tests := []struct {
+		name   string
+		header func() *LayoutNode
+		footer func() *LayoutNode
+		// rects of the first child of the header and footer, which are the
+		// same on every page
+		headerRect, footerRect testRect
+		headers, footers       []string
+	}{
+		{
+			name: "header with page numbers",
+			header: func() *LayoutNode {
+				return Text(nil, LayoutNodeProps{Width: WidthFill(), Height: HeightFill()}, TextNode{Text: "{page} / {pages}", FontSize: 8})
+			},
+			headerRect: testRect{10, 0, width, 10},
+			headers:    []string{"1 / 3", "2 / 3", "3 / 3"},
+		},
+		{
+			name: "footer inside of the bottom margin",
+			footer: func() *LayoutNode {
+				return Text(nil, LayoutNodeProps{Width: WidthPercentage(50), Height: StaticSize(5)}, TextNode{Text: "Page {page}", FontSize: 8})
+			},
+			footerRect: testRect{10, 269.4, width / 2, 5},
+			footers:    []string{"Page 1", "Page 2", "Page 3"},
+		},
+		{
+			name: "placeholders in nested rich text",
+			header: func() *LayoutNode {
+				return Div(nil, LayoutNodeProps{Width: WidthFill(), Height: HeightFill(), Padding: NewSingletonSizeQuad(2)}, func(parent *LayoutNode) {
+					RichText(parent, LayoutNodeProps{Width: WidthFill(), Height: HeightFill()}, RichTextNode{Spans: []TextSpan{
+						{Text: "Page ", FontFamily: "Inter", FontSize: 8},
+						{Text: "{page}", FontFamily: "Inter", FontStyle: FontBold, FontSize: 8},
+						{Text: " of {pages}", FontFamily: "Inter", FontSize: 8},
+					}})
+				})
+			},
+			footer: func() *LayoutNode {
+				return Div(nil, LayoutNodeProps{Width: WidthFill(), Height: HeightFill()}, NoChildren)
+			},
+			headerRect: testRect{10, 0, width, 10},
+			footerRect: testRect{10, 269.4, width, 10},
+			headers:    []string{"Page 1 of 3", "Page 2 of 3", "Page 3 of 3"},
+			footers:    []string{"", "", ""},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			builder := newTestBuilder(t)
+			var header, footer *LayoutNode
+			if test.header != nil {
+				header = test.header()
+				builder.SetHeader(header)
+			}
+			if test.footer != nil {
+				footer = test.footer()
+				builder.SetFooter(footer)
+			}
+
+			err := builder.CreateDocumentTree([]*LayoutNode{
+				box(200, LayoutNodeProps{}),
+				box(200, LayoutNodeProps{}),
+				box(200, LayoutNodeProps{}),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pages := builder.document.Children
+			if len(pages) != 3 {
+				t.Fatalf("expected 3 pages, got %d", len(pages))
+			}
+
+			for idx, page := range pages {
+				if header == nil && page.Header != nil || footer == nil && page.Footer != nil {
+					t.Errorf("page %d: unexpected header or footer", idx+1)
+				}
+
+				if header != nil {
+					if rect := rectOf(t, page.Header.Children[0]); !rect.equals(test.headerRect) {
+						t.Errorf("page %d: expected header at %+v, got %+v", idx+1, test.headerRect, rect)
+					}
+					if text := decorationText(page.Header); text != test.headers[idx] {
+						t.Errorf("page %d: expected header %q, got %q", idx+1, test.headers[idx], text)
+					}
+				}
+
+				if footer != nil {
+					if rect := rectOf(t, page.Footer.Children[0]); !rect.equals(test.footerRect) {
+						t.Errorf("page %d: expected footer at %+v, got %+v", idx+1, test.footerRect, rect)
+					}
+					if text := decorationText(page.Footer); text != test.footers[idx] {
+						t.Errorf("page %d: expected footer %q, got %q", idx+1, test.footers[idx], text)
+					}
+				}
+			}
+
+			// every page gets its own copy of the trees, so the placeholders
+			// are left in the originals
+			for _, tree := range []*LayoutNode{header, footer} {
+				if tree != nil && decorationText(tree) != "" && !strings.Contains(decorationText(tree), PageNumberPlaceholder) {
+					t.Errorf("the placeholders were replaced in the original tree: %q", decorationText(tree))
+				}
+			}
+		})
+	}
+}
+
+// childRects lays out a container at the top of the page that fills the width
+// of the page, and is 100mm tall unless given a height, with a child for each
+// of the given props, and returns the render rects of the children
+func childRects(t *testing.T, container LayoutNodeProps, children ...LayoutNodeProps) []testRect {
+	t.Helper()
+
+	container.Width = WidthFill()
+	if container.Height.isUnitialized() {
+		container.Height = StaticSize(100)
+	}
+	node := Div(nil, container, func(parent *LayoutNode) {
+		for _, props := range children {
+			Div(parent, props, NoChildren)
+		}
+	})
+	layoutNodes(t, node)
+
+	rects := make([]testRect, len(node.Children))
+	for idx, child := range node.Children {
+		rects[idx] = rectOf(t, child)
+	}
+	return rects
+}
+
+func assertRects(t *testing.T, expected []testRect, actual []testRect) {
+	t.Helper()
+
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %+v, got %+v", expected, actual)
+	}
+	for idx := range expected {
+		if !actual[idx].equals(expected[idx]) {
+			t.Errorf("node %d: expected %+v, got %+v", idx, expected[idx], actual[idx])
+		}
+	}
+}
+
+// staticChildren returns props for children with static sizes
+func staticChildren(sizes ...[2]Size) []LayoutNodeProps {
+	children := make([]LayoutNodeProps, len(sizes))
+	for idx, size := range sizes {
+		children[idx] = LayoutNodeProps{Width: StaticSize(size[0]), Height: StaticSize(size[1])}
+	}
+	return children
+}
+
+func TestPageDecorationTallerThanMargin(t *testing.T) {
+	tests := []struct {
+		name     string
+		set      func(builder *DocumentBuilder, decoration *LayoutNode)
+		expected string
+	}{
+		{"header", (*DocumentBuilder).SetHeader, "node(header) > node(title)"},
+		{"footer", (*DocumentBuilder).SetFooter, "node(footer) > node(title)"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			builder := newTestBuilder(t)
+			test.set(builder, Div(nil, LayoutNodeProps{ID: "title", Width: WidthFill(), Height: StaticSize(15)}, NoChildren))
+
+			err := builder.CreateDocumentTree([]*LayoutNode{box(50, LayoutNodeProps{})})
+			var overflow *OverflowError
+			if !errors.As(err, &overflow) || overflow.Path.String() != test.expected || overflow.Size != 15 || overflow.Available != testPageMargin {
+				t.Errorf("expected an overflow error for %s, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestChildDistribution(t *testing.T) {
+	// the children of the rows leave 100mm of free space
+	row := staticChildren([2]Size{20, 10}, [2]Size{30, 10}, [2]Size{45.9, 10})
+	// the children of the columns leave 40mm of free space
+	column := staticChildren([2]Size{10, 20}, [2]Size{10, 30}, [2]Size{10, 10})
+
+	tests := []struct {
+		name      string
+		direction childFlowDirection
+		alignment LayoutChildAlignment
+		children  []LayoutNodeProps
+		expected  []testRect
+	}{
+		{
+			name:      "start",
+			direction: FlowHorizontal,
+			alignment: LayoutChildAlignment{Horizontal: Start},
+			children:  row,
+			expected:  []testRect{{10, 10, 20, 10}, {30, 10, 30, 10}, {60, 10, 45.9, 10}},
+		},
+		{
+			name:      "end",
+			direction: FlowHorizontal,
+			alignment: LayoutChildAlignment{Horizontal: End},
+			children:  row,
+			expected:  []testRect{{110, 10, 20, 10}, {130, 10, 30, 10}, {160, 10, 45.9, 10}},
+		},
+		{
+			name:      "center",
+			direction: FlowHorizontal,
+			alignment: LayoutChildAlignment{Horizontal: Center},
+			children:  row,
+			expected:  []testRect{{60, 10, 20, 10}, {80, 10, 30, 10}, {110, 10, 45.9, 10}},
+		},
+		{
+			name:      "space between",
+			direction: FlowHorizontal,
+			alignment: LayoutChildAlignment{Horizontal: SpaceBetween},
+			children:  row,
+			expected:  []testRect{{10, 10, 20, 10}, {80, 10, 30, 10}, {160, 10, 45.9, 10}},
+		},
+		{
+			name:      "space around",
+			direction: FlowHorizontal,
+			alignment: LayoutChildAlignment{Horizontal: SpaceAround},
+			children:  row,
+			expected:  []testRect{{10 + 100.0/6, 10, 20, 10}, {80, 10, 30, 10}, {160 - 100.0/6, 10, 45.9, 10}},
+		},
+		{
+			name:      "space evenly",
+			direction: FlowHorizontal,
+			alignment: LayoutChildAlignment{Horizontal: SpaceEvenly},
+			children:  row,
+			expected:  []testRect{{35, 10, 20, 10}, {80, 10, 30, 10}, {135, 10, 45.9, 10}},
+		},
+		{
+			name:      "space between with a single child",
+			direction: FlowHorizontal,
+			alignment: LayoutChildAlignment{Horizontal: SpaceBetween},
+			children:  row[:1],
+			expected:  []testRect{{10, 10, 20, 10}},
+		},
+		{
+			name:      "space around with a single child",
+			direction: FlowHorizontal,
+			alignment: LayoutChildAlignment{Horizontal: SpaceAround},
+			children:  row[:1],
+			expected:  []testRect{{97.95, 10, 20, 10}},
+		},
+		{
+			name:      "distribution along the cross axis behaves like start",
+			direction: FlowHorizontal,
+			alignment: LayoutChildAlignment{Horizontal: SpaceBetween, Vertical: SpaceEvenly},
+			children:  row,
+			expected:  []testRect{{10, 10, 20, 10}, {80, 10, 30, 10}, {160, 10, 45.9, 10}},
+		},
+		{
+			name:      "space between in a column",
+			direction: FlowVertical,
+			alignment: LayoutChildAlignment{Vertical: SpaceBetween},
+			children:  column,
+			expected:  []testRect{{10, 10, 10, 20}, {10, 50, 10, 30}, {10, 100, 10, 10}},
+		},
+		{
+			name:      "space evenly in a column",
+			direction: FlowVertical,
+			alignment: LayoutChildAlignment{Vertical: SpaceEvenly},
+			children:  column,
+			expected:  []testRect{{10, 20, 10, 20}, {10, 50, 10, 30}, {10, 90, 10, 10}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			container := LayoutNodeProps{ChildFlowDirection: test.direction, ChildAlignment: test.alignment}
+			assertRects(t, test.expected, childRects(t, container, test.children...))
+		})
+	}
+}
+
+func TestWrappingRows(t *testing.T) {
+	tests := []struct {
+		name      string
+		container LayoutNodeProps
+		children  []LayoutNodeProps
+		expected  []testRect
+	}{
+		{
+			name:     "children that overflow the line start a new one",
+			children: staticChildren([2]Size{80, 10}, [2]Size{80, 20}, [2]Size{80, 10}),
+			expected: []testRect{{10, 10, 80, 10}, {90, 10, 80, 20}, {10, 30, 80, 10}},
+		},
+		{
+			name:     "child wider than the line is placed on a line of its own",
+			children: staticChildren([2]Size{200, 10}, [2]Size{50, 10}, [2]Size{50, 10}),
+			expected: []testRect{{10, 10, 200, 10}, {10, 20, 50, 10}, {60, 20, 50, 10}},
+		},
+		{
+			name: "fills share the free space of their own line",
+			children: []LayoutNodeProps{
+				{FlexGrow: 1, FlexBasis: StaticSize(100), Height: StaticSize(10)},
+				{FlexGrow: 1, FlexBasis: StaticSize(100), Height: StaticSize(10)},
+				{Width: StaticSize(50), Height: StaticSize(10)},
+			},
+			expected: []testRect{{10, 10, 195.9, 10}, {10, 20, 145.9, 10}, {155.9, 20, 50, 10}},
+		},
+		{
+			name:      "each line is aligned on its own",
+			container: LayoutNodeProps{ChildAlignment: LayoutChildAlignment{Horizontal: Center}},
+			children:  staticChildren([2]Size{80, 10}, [2]Size{80, 10}, [2]Size{80, 10}),
+			expected:  []testRect{{27.95, 10, 80, 10}, {107.95, 10, 80, 10}, {67.95, 20, 80, 10}},
+		},
+		{
+			name:      "children are aligned within the height of their line",
+			container: LayoutNodeProps{Height: HeightAsChildren(), ChildAlignment: LayoutChildAlignment{Vertical: Center}},
+			children:  staticChildren([2]Size{80, 10}, [2]Size{80, 20}, [2]Size{80, 10}),
+			expected:  []testRect{{10, 15, 80, 10}, {90, 10, 80, 20}, {10, 30, 80, 10}},
+		},
+		{
+			name:      "lines are aligned together within the container",
+			container: LayoutNodeProps{ChildAlignment: LayoutChildAlignment{Vertical: Center}},
+			children:  staticChildren([2]Size{80, 10}, [2]Size{80, 20}, [2]Size{80, 10}),
+			expected:  []testRect{{10, 50, 80, 10}, {90, 45, 80, 20}, {10, 65, 80, 10}},
+		},
+		{
+			name:      "container as tall as its lines",
+			container: LayoutNodeProps{Height: HeightAsChildren(), ChildAlignment: LayoutChildAlignment{Vertical: End}},
+			children:  staticChildren([2]Size{120, 10}, [2]Size{120, 30}, [2]Size{120, 20}),
+			expected:  []testRect{{10, 10, 120, 10}, {10, 20, 120, 30}, {10, 50, 120, 20}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.container.ChildFlowDirection = FlowHorizontal
+			test.container.ChildWrap = true
+			assertRects(t, test.expected, childRects(t, test.container, test.children...))
+		})
+	}
+}
+
+func TestGaps(t *testing.T) {
+	tests := []struct {
+		name      string
+		container LayoutNodeProps
+		children  []LayoutNodeProps
+		expected  []testRect
+	}{
+		{
+			name:      "column gap between the children of a row",
+			container: LayoutNodeProps{ChildFlowDirection: FlowHorizontal, ColumnGap: 10, RowGap: 50},
+			children:  staticChildren([2]Size{20, 10}, [2]Size{30, 10}),
+			expected:  []testRect{{10, 10, 20, 10}, {40, 10, 30, 10}},
+		},
+		{
+			name:      "row gap between the children of a column",
+			container: LayoutNodeProps{RowGap: 5, ColumnGap: 50},
+			children:  staticChildren([2]Size{10, 20}, [2]Size{10, 30}, [2]Size{10, 10}),
+			expected:  []testRect{{10, 10, 10, 20}, {10, 35, 10, 30}, {10, 70, 10, 10}},
+		},
+		{
+			name:      "fills share the space left after the gaps",
+			container: LayoutNodeProps{ChildFlowDirection: FlowHorizontal, ColumnGap: 15.9},
+			children: []LayoutNodeProps{
+				{Width: WidthFill(), Height: StaticSize(10)},
+				{Width: WidthFill(), Height: StaticSize(10)},
+			},
+			expected: []testRect{{10, 10, 90, 10}, {115.9, 10, 90, 10}},
+		},
+		{
+			name:      "gaps are added to the free space between distributed children",
+			container: LayoutNodeProps{ChildFlowDirection: FlowHorizontal, ColumnGap: 10, ChildAlignment: LayoutChildAlignment{Horizontal: SpaceEvenly}},
+			children:  staticChildren([2]Size{20, 10}, [2]Size{30, 10}, [2]Size{45.9, 10}),
+			expected:  []testRect{{30, 10, 20, 10}, {80, 10, 30, 10}, {140, 10, 45.9, 10}},
+		},
+		{
+			name:      "gaps between the items and lines of a wrapping row",
+			container: LayoutNodeProps{ChildFlowDirection: FlowHorizontal, ChildWrap: true, ColumnGap: 10, RowGap: 5},
+			children:  staticChildren([2]Size{80, 10}, [2]Size{80, 20}, [2]Size{80, 10}),
+			expected:  []testRect{{10, 10, 80, 10}, {100, 10, 80, 20}, {10, 35, 80, 10}},
+		},
+		{
+			name:      "node sized as its children includes the gaps",
+			container: LayoutNodeProps{Height: HeightAsChildren(), RowGap: 5, ChildAlignment: LayoutChildAlignment{Vertical: End}},
+			children:  staticChildren([2]Size{10, 10}, [2]Size{10, 10}, [2]Size{10, 10}),
+			expected:  []testRect{{10, 10, 10, 10}, {10, 25, 10, 10}, {10, 40, 10, 10}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assertRects(t, test.expected, childRects(t, test.container, test.children...))
+		})
+	}
+}
+
+func TestAlignSelf(t *testing.T) {
+	tests := []struct {
+		name      string
+		container LayoutNodeProps
+		children  []LayoutNodeProps
+		expected  []testRect
+	}{
+		{
+			name:      "children of a row override the vertical alignment",
+			container: LayoutNodeProps{ChildFlowDirection: FlowHorizontal, ChildAlignment: LayoutChildAlignment{Vertical: Center}},
+			children: []LayoutNodeProps{
+				{Width: StaticSize(20), Height: StaticSize(10)},
+				{Width: StaticSize(20), Height: StaticSize(10), AlignSelf: AlignSelfStart},
+				{Width: StaticSize(20), Height: StaticSize(10), AlignSelf: AlignSelfEnd},
+				{Width: StaticSize(20), Height: StaticSize(10), AlignSelf: AlignSelfCenter},
+			},
+			expected: []testRect{{10, 55, 20, 10}, {30, 10, 20, 10}, {50, 100, 20, 10}, {70, 55, 20, 10}},
+		},
+		{
+			name:      "children of a column override the horizontal alignment",
+			container: LayoutNodeProps{ChildAlignment: LayoutChildAlignment{Horizontal: End}},
+			children: []LayoutNodeProps{
+				{Width: StaticSize(20), Height: StaticSize(10)},
+				{Width: StaticSize(20), Height: StaticSize(10), AlignSelf: AlignSelfStart},
+				{Width: StaticSize(20), Height: StaticSize(10), AlignSelf: AlignSelfCenter},
+			},
+			expected: []testRect{{185.9, 10, 20, 10}, {10, 20, 20, 10}, {97.95, 30, 20, 10}},
+		},
+		{
+			name:      "alignment along the flow direction isn't overridden",
+			container: LayoutNodeProps{ChildFlowDirection: FlowHorizontal, ChildAlignment: LayoutChildAlignment{Horizontal: End}},
+			children: []LayoutNodeProps{
+				{Width: StaticSize(20), Height: StaticSize(10), AlignSelf: AlignSelfStart},
+				{Width: StaticSize(20), Height: StaticSize(10), AlignSelf: AlignSelfEnd},
+			},
+			expected: []testRect{{165.9, 10, 20, 10}, {185.9, 100, 20, 10}},
+		},
+		{
+			name:      "children of a wrapping row are aligned within their line",
+			container: LayoutNodeProps{ChildFlowDirection: FlowHorizontal, ChildWrap: true, Height: HeightAsChildren()},
+			children: []LayoutNodeProps{
+				{Width: StaticSize(80), Height: StaticSize(30)},
+				{Width: StaticSize(80), Height: StaticSize(10), AlignSelf: AlignSelfEnd},
+				{Width: StaticSize(80), Height: StaticSize(10), AlignSelf: AlignSelfCenter},
+			},
+			expected: []testRect{{10, 10, 80, 30}, {90, 30, 80, 10}, {10, 40, 80, 10}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assertRects(t, test.expected, childRects(t, test.container, test.children...))
+		})
+	}
+}
+
+func TestPositioning(t *testing.T) {
+	padded := LayoutNodeProps{Padding: NewSingletonSizeQuad(5)}
+
+	tests := []struct {
+		name      string
+		container LayoutNodeProps
+		children  []LayoutNodeProps
+		expected  []testRect
+	}{
+		{
+			name:      "static nodes ignore their offsets",
+			container: padded,
+			children: []LayoutNodeProps{
+				{Width: StaticSize(20), Height: StaticSize(10), OffsetX: 30, OffsetY: 30},
+				{Width: StaticSize(20), Height: StaticSize(10)},
+			},
+			expected: []testRect{{15, 15, 20, 10}, {15, 25, 20, 10}},
+		},
+		{
+			name:      "relative nodes move without moving their siblings",
+			container: padded,
+			children: []LayoutNodeProps{
+				{Width: StaticSize(20), Height: StaticSize(10), Position: PositionRelative, OffsetX: 30, OffsetY: -5},
+				{Width: StaticSize(20), Height: StaticSize(10)},
+			},
+			expected: []testRect{{45, 10, 20, 10}, {15, 25, 20, 10}},
+		},
+		{
+			name:      "absolute nodes are placed from the parent's render rect and leave the flow",
+			container: padded,
+			children: []LayoutNodeProps{
+				{Width: StaticSize(20), Height: StaticSize(10), Position: PositionAbsolute, OffsetX: 30, OffsetY: 40},
+				{Width: StaticSize(20), Height: StaticSize(10)},
+			},
+			expected: []testRect{{40, 50, 20, 10}, {15, 15, 20, 10}},
+		},
+		{
+			name:      "absolute nodes don't take part in the distribution of their siblings",
+			container: LayoutNodeProps{ChildFlowDirection: FlowHorizontal, ChildAlignment: LayoutChildAlignment{Horizontal: SpaceBetween}},
+			children: []LayoutNodeProps{
+				{Width: StaticSize(20), Height: StaticSize(10)},
+				{Width: StaticSize(20), Height: StaticSize(10), Position: PositionAbsolute},
+				{Width: StaticSize(20), Height: StaticSize(10)},
+			},
+			expected: []testRect{{10, 10, 20, 10}, {10, 10, 20, 10}, {185.9, 10, 20, 10}},
+		},
+		{
+			name:      "page nodes are placed from the corner of the page",
+			container: padded,
+			children: []LayoutNodeProps{
+				{Width: StaticSize(20), Height: StaticSize(10), Position: PositionPage, OffsetX: 5, OffsetY: 260},
+				{Width: StaticSize(20), Height: StaticSize(10)},
+			},
+			expected: []testRect{{5, 260, 20, 10}, {15, 15, 20, 10}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assertRects(t, test.expected, childRects(t, test.container, test.children...))
+		})
+	}
+}
+
+func TestTopLevelPositioning(t *testing.T) {
+	document := layoutNodes(t,
+		box(50, LayoutNodeProps{}),
+		Div(nil, LayoutNodeProps{Width: StaticSize(20), Height: StaticSize(10), Position: PositionAbsolute, OffsetX: 30, OffsetY: 40}, NoChildren),
+		Div(nil, LayoutNodeProps{Width: StaticSize(20), Height: StaticSize(10), Position: PositionRelative, OffsetX: 30}, NoChildren),
+		box(50, LayoutNodeProps{}),
+	)
+
+	assertPageRects(t, document, [][]testRect{{
+		{10, 10, 195.9, 50},
+		{40, 50, 20, 10},
+		{40, 60, 20, 10},
+		{10, 70, 195.9, 50},
+	}})
+}
@@ -0,0 +1,68 @@
+package docspec
+
+import "sort"
+
+/*
+Nodes are painted in "stacking order", which is a simplified version of CSS
+stacking contexts.  Every node with a non-zero ZIndex creates a stacking
+context, which is painted as a single layer together with all of its
+descendants.  Within a stacking context (and at the top level of each page),
+the layers with a negative ZIndex are painted first, then every other node in
+tree order, and finally the layers with a positive ZIndex.  Layers with the
+same ZIndex are painted in tree order, so that later nodes are painted over
+earlier ones, as before.
+*/
+
+// paintOrder returns every node in the trees below the given nodes (including
+// the nodes themselves) in the order in which they should be painted.
+func paintOrder(nodes []*LayoutNode) []*LayoutNode {
+	return stackingContextOrder(nil, nodes)
+}
+
+// stackingContextOrder returns the paint order of the stacking context created
+// by root, or of the top level of a page if root is nil.
+func stackingContextOrder(root *LayoutNode, children []*LayoutNode) []*LayoutNode {
+	order := make([]*LayoutNode, 0)
+	if root != nil {
+		order = append(order, root)
+	}
+
+	// nodes without a ZIndex are flattened into the current context, but any
+	// node that creates a context of its own is painted as a whole
+	flow := make([]*LayoutNode, 0)
+	contexts := make([]*LayoutNode, 0)
+
+	var collect func(nodes []*LayoutNode)
+	collect = func(nodes []*LayoutNode) {
+		for _, node := range nodes {
+			if node.ZIndex != 0 {
+				contexts = append(contexts, node)
+				continue
+			}
+
+			flow = append(flow, node)
+			collect(node.Children)
+		}
+	}
+	collect(children)
+
+	sort.SliceStable(contexts, func(i, j int) bool {
+		return contexts[i].ZIndex < contexts[j].ZIndex
+	})
+
+	for _, context := range contexts {
+		if context.ZIndex < 0 {
+			order = append(order, stackingContextOrder(context, context.Children)...)
+		}
+	}
+
+	order = append(order, flow...)
+
+	for _, context := range contexts {
+		if context.ZIndex > 0 {
+			order = append(order, stackingContextOrder(context, context.Children)...)
+		}
+	}
+
+	return order
+}
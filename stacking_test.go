@@ -0,0 +1,96 @@
+package docspec
+
+import (
+	"reflect"
+	"testing"
+)
+
+// stackingTree describes a node of a tree by its ID, ZIndex and children
+type stackingTree struct {
+	id       string
+	zIndex   int
+	children []stackingTree
+}
+
+func (s stackingTree) build(parent *LayoutNode) *LayoutNode {
+	return Div(parent, LayoutNodeProps{ID: s.id, ZIndex: s.zIndex}, func(node *LayoutNode) {
+		for _, child := range s.children {
+			child.build(node)
+		}
+	})
+}
+
+func TestPaintOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		trees    []stackingTree
+		expected []string
+	}{
+		{
+			name: "tree order without any z-index",
+			trees: []stackingTree{
+				{id: "a", children: []stackingTree{{id: "a1"}, {id: "a2"}}},
+				{id: "b"},
+			},
+			expected: []string{"a", "a1", "a2", "b"},
+		},
+		{
+			name: "positive z-index is painted over its later siblings",
+			trees: []stackingTree{
+				{id: "a", zIndex: 1, children: []stackingTree{{id: "a1"}}},
+				{id: "b"},
+			},
+			expected: []string{"b", "a", "a1"},
+		},
+		{
+			name: "negative z-index is painted under its earlier siblings",
+			trees: []stackingTree{
+				{id: "a"},
+				{id: "b", zIndex: -1, children: []stackingTree{{id: "b1"}}},
+			},
+			expected: []string{"b", "b1", "a"},
+		},
+		{
+			name: "descendants without a stacking context of their own are stacked with the page",
+			trees: []stackingTree{
+				{id: "a", children: []stackingTree{{id: "a1", zIndex: 1}, {id: "a2"}}},
+				{id: "b"},
+			},
+			expected: []string{"a", "a2", "b", "a1"},
+		},
+		{
+			name: "stacking context paints its descendants as a single layer",
+			trees: []stackingTree{
+				{id: "a", zIndex: 1, children: []stackingTree{{id: "a1", zIndex: 5}, {id: "a2", zIndex: -1}, {id: "a3"}}},
+				{id: "b", zIndex: 2},
+			},
+			expected: []string{"a", "a2", "a3", "a1", "b"},
+		},
+		{
+			name: "equal z-indexes are painted in tree order",
+			trees: []stackingTree{
+				{id: "a", zIndex: 1},
+				{id: "b", zIndex: 1},
+				{id: "c"},
+			},
+			expected: []string{"c", "a", "b"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nodes := make([]*LayoutNode, len(test.trees))
+			for idx, tree := range test.trees {
+				nodes[idx] = tree.build(nil)
+			}
+
+			order := make([]string, 0)
+			for _, node := range paintOrder(nodes) {
+				order = append(order, node.ID)
+			}
+			if !reflect.DeepEqual(order, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, order)
+			}
+		})
+	}
+}
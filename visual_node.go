@@ -2,8 +2,10 @@ package docspec
 
 import (
 	"bytes"
+	"fmt"
 	"image"
 	"io"
+	"math"
 	"os"
 
 	// registers the gif format
@@ -24,9 +26,33 @@ inside layout nodes.  Examples of content would include text or images.
 type textAlignment = int
 
 const (
-	textLeft textAlignment = iota
-	textCenter
-	textRight
+	// TextLeft aligns each line of a TextNode with the left edge of its parent
+	TextLeft textAlignment = iota
+	// TextCenter centers each line of a TextNode within its parent
+	TextCenter
+	// TextRight aligns each line of a TextNode with the right edge of its
+	// parent
+	TextRight
+	// TextJustify spreads the words of each line of a TextNode across the
+	// full width of its parent, except for the last line, which is aligned
+	// left
+	TextJustify
+)
+
+type textVerticalAlignment = int
+
+const (
+	// TextTop places the lines of a TextNode at the top of its parent
+	TextTop textVerticalAlignment = iota
+	// TextMiddle centers the lines of a TextNode vertically within its parent
+	TextMiddle
+	// TextBottom places the lines of a TextNode at the bottom of its parent
+	TextBottom
+	// TextBaseline places the baseline of the last line of a TextNode on the
+	// bottom edge of its parent's draw rect, with the descenders hanging into
+	// the padding below, so that text of different sizes in neighbouring
+	// nodes of the same height sits on the same line
+	TextBaseline
 )
 
 type overflowBehavior = int
@@ -62,10 +88,20 @@ type TextNode struct {
 	FontSize Size
 	Color    Color
 	// multiplier used to determine line height based on font size
-	LineHeight       Size
-	Alignment        textAlignment
-	Link             string
-	OverflowBehavior overflowBehavior
+	LineHeight        Size
+	Alignment         textAlignment
+	VerticalAlignment textVerticalAlignment
+	Link              string
+	OverflowBehavior  overflowBehavior
+	// language whose patterns are used to hyphenate words that don't fit at
+	// the end of a line, e.g. HyphenationEnglish.  Text is not hyphenated if
+	// this is empty, but soft hyphens (U+00AD) in the text are always honored.
+	Hyphenation string
+
+	// continued is set on the fragments of a text node that has been split
+	// between pages, other than the last one, whose last line is not the end
+	// of the paragraph
+	continued bool
 }
 
 // getLineHeightMM returns the line height in mm for a given text node
@@ -73,8 +109,109 @@ func (n *TextNode) getLineHeightMM() float64 {
 	if n.LineHeight == 0 {
 		n.LineHeight = 1.0
 	}
+	return n.getFontSizeMM() * n.LineHeight
+}
+
+// getFontSizeMM returns the font size of a text node in mm
+func (n *TextNode) getFontSizeMM() float64 {
+	conversionFactor := 0.3528
+	return n.FontSize * conversionFactor
+}
+
+/* --------------------------- Rich Text Node -------------------------- */
+
+// TextSpan is a run of text within a RichTextNode that is drawn in a single
+// style
+type TextSpan struct {
+	Text       string
+	FontFamily string
+	FontStyle  fontStyle
+	// size of the font in points (1pt == 0.3528mm)
+	FontSize  Size
+	Color     Color
+	Link      string
+	Underline bool
+}
+
+// RichTextNode represents a paragraph of text made of spans with different
+// styles.  The spans are wrapped together as one paragraph, and the spans on
+// each line share a baseline.
+type RichTextNode struct {
+	Spans []TextSpan
+	// size of the font in points of lines without any spans, such as the
+	// only line of an empty paragraph, which are measured like a line of a
+	// TextNode with this font size
+	FontSize Size
+	// multiplier used to determine the height of each line based on the
+	// largest font size on the line
+	LineHeight        Size
+	Alignment         textAlignment
+	VerticalAlignment textVerticalAlignment
+	OverflowBehavior  overflowBehavior
+
+	// see TextNode
+	continued bool
+}
+
+// getLineHeightMM returns the height in mm of a line of a rich text node made
+// of the given spans
+func (n *RichTextNode) getLineHeightMM(line []TextSpan) float64 {
+	lineHeight := n.LineHeight
+	if lineHeight == 0 {
+		lineHeight = 1.0
+	}
+	return n.lineFontSizeMM(line) * lineHeight
+}
+
+// getBaselineMM returns the distance in mm from the top of a line of a rich
+// text node to its baseline.  gofpdf draws the baseline 0.3 ems below the
+// middle of the line, and the baseline is shared by the largest font on the
+// line.
+func (n *RichTextNode) getBaselineMM(line []TextSpan) float64 {
+	return n.getLineHeightMM(line)/2 + 0.3*n.lineFontSizeMM(line)
+}
+
+// lineFontSizeMM returns the size in mm of the largest font on a line of a
+// rich text node, or of its base font if the line has no spans
+func (n *RichTextNode) lineFontSizeMM(line []TextSpan) float64 {
+	if len(line) == 0 {
+		conversionFactor := 0.3528
+		return n.FontSize * conversionFactor
+	}
+	return largestFontSizeMM(line)
+}
+
+// getFontSizeMM returns the font size of a span in mm
+func (s *TextSpan) getFontSizeMM() float64 {
 	conversionFactor := 0.3528
-	return (n.FontSize * conversionFactor) * n.LineHeight
+	return s.FontSize * conversionFactor
+}
+
+func largestFontSizeMM(spans []TextSpan) float64 {
+	largest := emptySize
+	for _, span := range spans {
+		largest = math.Max(largest, span.getFontSizeMM())
+	}
+	return largest
+}
+
+// spansText returns the text of all of the spans joined together
+func spansText(spans []TextSpan) string {
+	text := ""
+	for _, span := range spans {
+		text += span.Text
+	}
+	return text
+}
+
+// flattenTextLines joins wrapped lines of a rich text node back into a single
+// list of spans
+func flattenTextLines(lines [][]TextSpan) []TextSpan {
+	spans := make([]TextSpan, 0)
+	for _, line := range lines {
+		spans = append(spans, line...)
+	}
+	return spans
 }
 
 /* -----------------------------  Image Node ---------------------------- */
@@ -130,6 +267,26 @@ func (n *ImageNode) getBytesReader() (io.Reader, error) {
 	return bytes.NewReader(n.data), nil
 }
 
+// getAspectRatio returns the intrinsic aspect ratio (width / height) of the
+// image
+func (n *ImageNode) getAspectRatio() (Size, error) {
+	dataReader, err := n.getBytesReader()
+	if err != nil {
+		return emptySize, err
+	}
+
+	config, _, err := image.DecodeConfig(dataReader)
+	if err != nil {
+		return emptySize, err
+	}
+
+	if config.Height == 0 {
+		return emptySize, fmt.Errorf("image %s has a height of 0", n.Src)
+	}
+
+	return Size(config.Width) / Size(config.Height), nil
+}
+
 // getDrawRect calculates the width and height of the image for the required
 // fit.
 func (n *ImageNode) getDrawRect(parentRect Rect) (Rect, error) {